@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around every change.
+const contextLines = 3
+
+type operation struct {
+	kind byte   // ' ', '-' or '+'
+	line string // Includes the newline, unless it's the last line of a source without one
+
+	// oldLine and newLine are the zero based lines the operation is at
+	oldLine, newLine int
+}
+
+// unifiedDiff returns the difference of two sources in the unified format.
+// Sources are small, so a quadratic longest common subsequence is enough.
+func unifiedDiff(filename, old, new string) string {
+	operations := diffLines(splitLines(old), splitLines(new))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", filename, filename)
+
+	for i := 0; i < len(operations); {
+		if operations[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		start := max(i-contextLines, 0)
+
+		// A hunk goes on while changes are closer than twice the context
+		end, unchanged := i, 0
+		for end < len(operations) && unchanged <= 2*contextLines {
+			if operations[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		end -= max(unchanged-contextLines, 0)
+
+		writeHunk(&sb, operations[start:end])
+		i = end
+	}
+
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, hunk []operation) {
+	oldCount, newCount := 0, 0
+	for _, op := range hunk {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n",
+		hunkRange(hunk[0].oldLine, oldCount), hunkRange(hunk[0].newLine, newCount))
+	for _, op := range hunk {
+		sb.WriteByte(op.kind)
+		sb.WriteString(op.line)
+
+		if !strings.HasSuffix(op.line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(line, count int) string {
+	// Empty ranges point at the line before them
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
+
+func diffLines(old, new []string) []operation {
+	// lcs[i][j] is the length of the common subsequence of old[i:] and new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	operations := []operation{}
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			operations = append(operations, operation{' ', old[i], i, j})
+			i++
+			j++
+		case j < len(new) && (i == len(old) || lcs[i][j+1] > lcs[i+1][j]):
+			operations = append(operations, operation{'+', new[j], i, j})
+			j++
+		default:
+			operations = append(operations, operation{'-', old[i], i, j})
+			i++
+		}
+	}
+
+	return operations
+}
+
+// splitLines keeps the newlines, so a missing newline at the end of a source
+// is a difference too.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			"single change",
+			numbered(10),
+			strings.Replace(numbered(10), "5\n", "x\n", 1),
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n",
+		},
+		{
+			"changes closer than twice the context",
+			numbered(20),
+			strings.Replace(strings.Replace(numbered(20), "\n5\n", "\nx\n", 1), "\n12\n", "\ny\n", 1),
+			"@@ -2,14 +2,14 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n 9\n 10\n 11\n-12\n+y\n 13\n 14\n 15\n",
+		},
+		{
+			"changes farther than twice the context",
+			numbered(20),
+			strings.Replace(strings.Replace(numbered(20), "\n5\n", "\nx\n", 1), "\n13\n", "\ny\n", 1),
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n" +
+				"@@ -10,7 +10,7 @@\n 10\n 11\n 12\n-13\n+y\n 14\n 15\n 16\n",
+		},
+		{
+			"insert only",
+			"",
+			"a\nb\n",
+			"@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			"insert in the middle",
+			numbered(3),
+			"1\n2\nx\n3\n",
+			"@@ -1,3 +1,4 @@\n 1\n 2\n+x\n 3\n",
+		},
+		{
+			"delete only",
+			"a\nb\n",
+			"",
+			"@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			"missing newline at the end",
+			"a\nb",
+			"a\nb\n",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"no changes",
+			numbered(3),
+			numbered(3),
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		expected := "--- a.monkey\n+++ a.monkey\n" + tt.expected
+
+		if got := unifiedDiff("a.monkey", tt.old, tt.new); got != expected {
+			t.Fatalf("Wrong diff for %s, want=\n%s\ngot=\n%s", tt.name, expected, got)
+		}
+	}
+}
+
+// numbered returns a text with lines 1 to n.
+func numbered(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "%d\n", i)
+	}
+	return sb.String()
+}
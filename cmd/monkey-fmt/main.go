@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/formatter"
+	"github.com/marcsek/monkey-language-server/internal/sources"
+)
+
+const usage = `usage: monkey-fmt [flags] [path ...]
+
+Formats Monkey sources. Directories are walked for .monkey files, without
+paths the standard input is formatted to the standard output.
+
+Flags:
+`
+
+var (
+	write    = flag.Bool("w", false, "write the result to the source file instead of standard output")
+	showDiff = flag.Bool("d", false, "print diffs instead of the formatted sources")
+	list     = flag.Bool("l", false, "list files whose formatting differs")
+
+	indent   = flag.Int("indent", 2, "number of spaces per indentation level")
+	useTabs  = flag.Bool("tabs", false, "indent with tabs")
+	maxWidth = flag.Int("width", 80, "column at which lists are broken into lines")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	options := formatter.Options{IndentSize: *indent, UseTabs: *useTabs, MaxWidth: *maxWidth}
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "monkey-fmt: can't use -w with standard input")
+			os.Exit(2)
+		}
+
+		if err := processFile("<stdin>", os.Stdin, os.Stdout, options); err != nil {
+			fmt.Fprintf(os.Stderr, "monkey-fmt: %s\n", err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		files, err := sources.Files(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey-fmt: %s\n", err)
+			failed = true
+			continue
+		}
+
+		for _, file := range files {
+			if err := processPath(file, options); err != nil {
+				fmt.Fprintf(os.Stderr, "monkey-fmt: %s\n", err)
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(2)
+	}
+}
+
+func processPath(path string, options formatter.Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return processFile(path, f, os.Stdout, options)
+}
+
+func processFile(filename string, in io.Reader, out io.Writer, options formatter.Options) error {
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := formatter.Source(string(src), options)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	changed := !bytes.Equal(src, []byte(formatted))
+
+	if *list && changed {
+		fmt.Fprintln(out, filename)
+	}
+
+	if *write && changed {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(filename, []byte(formatted), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if *showDiff && changed {
+		fmt.Fprint(out, unifiedDiff(filename, string(src), formatted))
+	}
+
+	if !*list && !*write && !*showDiff {
+		fmt.Fprint(out, formatted)
+	}
+
+	return nil
+}
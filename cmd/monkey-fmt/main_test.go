@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/formatter"
+)
+
+func TestProcessFile(t *testing.T) {
+	const source = "let a=1\nlet b =[a,2]"
+
+	options := formatter.Options{IndentSize: 2, MaxWidth: 80}
+	formatted, err := formatter.Source(source, options)
+	if err != nil {
+		t.Fatalf("Unexpected formatter error: %s", err)
+	}
+
+	tests := []struct {
+		name           string
+		flag           *bool
+		expectedOutput func(path string) string
+		expectedFile   string
+	}{
+		{"default", nil, func(string) string { return formatted }, source},
+		{"-l", list, func(path string) string { return path + "\n" }, source},
+		{"-d", showDiff, func(path string) string { return unifiedDiff(path, source, formatted) }, source},
+		{"-w", write, func(string) string { return "" }, formatted},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "a.monkey")
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if tt.flag != nil {
+			*tt.flag = true
+		}
+
+		var out bytes.Buffer
+		err := processFile(path, strings.NewReader(source), &out, options)
+
+		if tt.flag != nil {
+			*tt.flag = false
+		}
+
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", tt.name, err)
+		}
+
+		if expected := tt.expectedOutput(path); out.String() != expected {
+			t.Fatalf("Wrong output for %s, want=%q; got=%q", tt.name, expected, out.String())
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != tt.expectedFile {
+			t.Fatalf("Wrong file content for %s, want=%q; got=%q", tt.name, tt.expectedFile, content)
+		}
+	}
+}
+
+func TestProcessFileUnchanged(t *testing.T) {
+	const source = "let a = 1;\n"
+
+	options := formatter.Options{IndentSize: 2, MaxWidth: 80}
+
+	for _, flag := range []*bool{list, showDiff} {
+		*flag = true
+
+		var out bytes.Buffer
+		err := processFile("a.monkey", strings.NewReader(source), &out, options)
+
+		*flag = false
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if out.Len() != 0 {
+			t.Fatalf("Formatted file shouldn't be reported, got=%q", out.String())
+		}
+	}
+}
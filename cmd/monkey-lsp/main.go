@@ -1,7 +1,8 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"io"
 	"log"
 	"os"
 
@@ -19,22 +20,27 @@ func main() {
 	reader := os.Stdin
 	writer := os.Stdout
 
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(rpc.SplicFunc)
+	rpcReader := rpc.NewReader(reader)
 
 	state := analysis.NewState(logger)
 
 	messageHandler := messageHandler.New(reader, writer, state, logger)
 
-	for scanner.Scan() {
-		msg := scanner.Bytes()
-		method, contents, err := rpc.DecodeMessage(msg)
+	for {
+		method, contents, err := rpcReader.ReadMessage()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
 		if err != nil {
-			logger.Printf("Got and error: %s\n", err)
+			// The reader skips to the next message after framing errors
+			messageHandler.HandleDecodeError(err)
+			continue
 		}
 
-		messageHandler.HandleMessage(method, contents)
+		messageHandler.Dispatch(method, contents)
 	}
+
+	messageHandler.Wait()
 }
 
 func getLogger(filename string) *log.Logger {
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/marcsek/monkey-language-server/internal/analysis"
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	diagnostic_severity "github.com/marcsek/monkey-language-server/internal/lsp/DiagnosticSeverity"
+	"github.com/marcsek/monkey-language-server/internal/sources"
+)
+
+const checkUsage = `usage: monkey check [flags] [path ...]
+
+Reports problems in Monkey sources, the same ones the language server shows.
+Directories are walked for .monkey files, without paths the current directory
+is checked. Exits with 1 when an error is found and with 2 when a file can't
+be read.
+
+Flags:
+`
+
+// fileReport holds diagnostics of a single checked file.
+type fileReport struct {
+	Path        string           `json:"path"`
+	Diagnostics []lsp.Diagnostic `json:"diagnostics"`
+}
+
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	format := flags.String("format", "human", "output format: human, json or sarif")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, checkUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	write, ok := reportWriters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "monkey check: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	reports, failed := checkPaths(paths)
+
+	if err := write(os.Stdout, reports); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey check: %s\n", err)
+		os.Exit(2)
+	}
+
+	if code := exitCode(reports, failed); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// exitCode is 2 when some file couldn't be read, otherwise 1 when there is an
+// error and 0 when there are only warnings or nothing.
+func exitCode(reports []fileReport, failed bool) int {
+	switch {
+	case failed:
+		return 2
+	case hasErrors(reports):
+		return 1
+	}
+	return 0
+}
+
+// checkPaths reports every file it could read, failed is set when some
+// couldn't.
+func checkPaths(paths []string) (reports []fileReport, failed bool) {
+	logger := log.New(io.Discard, "", 0)
+	reports = []fileReport{}
+
+	for _, path := range paths {
+		files, err := sources.Files(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey check: %s\n", err)
+			failed = true
+			continue
+		}
+
+		for _, file := range files {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "monkey check: %s\n", err)
+				failed = true
+				continue
+			}
+
+			diagnostics := analysis.Analyze(string(src), logger).Diagnostics
+			sort.SliceStable(diagnostics, func(i, j int) bool {
+				return before(diagnostics[i].Range.Start, diagnostics[j].Range.Start)
+			})
+
+			reports = append(reports, fileReport{Path: file, Diagnostics: diagnostics})
+		}
+	}
+
+	return reports, failed
+}
+
+func hasErrors(reports []fileReport) bool {
+	for _, report := range reports {
+		for _, diagnostic := range report.Diagnostics {
+			if diagnostic.Severity == diagnostic_severity.Error {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func before(a, b lsp.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Character < b.Character
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	diagnostic_severity "github.com/marcsek/monkey-language-server/internal/lsp/DiagnosticSeverity"
+)
+
+func TestExitCode(t *testing.T) {
+	withSeverity := func(severity int) []fileReport {
+		return []fileReport{{Path: "a.monkey", Diagnostics: []lsp.Diagnostic{{Severity: severity}}}}
+	}
+
+	tests := []struct {
+		name     string
+		reports  []fileReport
+		failed   bool
+		expected int
+	}{
+		{"clean", []fileReport{{Path: "a.monkey", Diagnostics: []lsp.Diagnostic{}}}, false, 0},
+		{"warning", withSeverity(diagnostic_severity.Warning), false, 0},
+		{"error", withSeverity(diagnostic_severity.Error), false, 1},
+		{"unreadable", []fileReport{}, true, 2},
+		{"unreadable and error", withSeverity(diagnostic_severity.Error), true, 2},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.reports, tt.failed); got != tt.expected {
+			t.Fatalf("Wrong exit code for %s, want=%d; got=%d", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestCheckPaths(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.monkey": "let a = 1;\n",
+		"bad.monkey":  "let b = c;\nlet = 1;\n",
+		"ignored.txt": "let = 1;\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, failed := checkPaths([]string{dir})
+	if failed {
+		t.Fatalf("Check of %s shouldn't fail", dir)
+	}
+
+	if len(reports) != 2 {
+		t.Fatalf("Wrong number of reports, want=2; got=%d", len(reports))
+	}
+
+	// Files come in walk order, diagnostics in source order
+	bad := reports[0]
+	if bad.Path != filepath.Join(dir, "bad.monkey") || len(bad.Diagnostics) < 2 {
+		t.Fatalf("Wrong report of bad.monkey, got=%+v", bad)
+	}
+	for i := 1; i < len(bad.Diagnostics); i++ {
+		if before(bad.Diagnostics[i].Range.Start, bad.Diagnostics[i-1].Range.Start) {
+			t.Fatalf("Diagnostics aren't sorted, got=%+v", bad.Diagnostics)
+		}
+	}
+
+	if good := reports[1]; len(good.Diagnostics) != 0 {
+		t.Fatalf("Unexpected diagnostics in good.monkey, got=%+v", good.Diagnostics)
+	}
+
+	if exitCode(reports, failed) != 1 {
+		t.Fatalf("Wrong exit code, want=1; got=%d", exitCode(reports, failed))
+	}
+
+	reports, failed = checkPaths([]string{filepath.Join(dir, "missing.monkey")})
+	if !failed || exitCode(reports, failed) != 2 {
+		t.Fatalf("Missing file should fail with 2, got=%d", exitCode(reports, failed))
+	}
+}
+
+func TestCheckPathsUsesUTF16Columns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.monkey")
+	if err := os.WriteFile(path, []byte(`let s = "é"; zz`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, _ := checkPaths([]string{path})
+	if len(reports) != 1 || len(reports[0].Diagnostics) != 1 {
+		t.Fatalf("Expected a single diagnostic, got=%+v", reports)
+	}
+
+	// The same column the language server reports
+	if got := reports[0].Diagnostics[0].Range.Start.Character; got != 13 {
+		t.Fatalf("Wrong column, want=13; got=%d", got)
+	}
+}
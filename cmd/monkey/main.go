@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: monkey <command> [arguments]
+
+Commands:
+  repl    start an interactive session
+  check   report problems in sources
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "repl":
+		runRepl(os.Args[2:])
+	case "check":
+		runCheck(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "monkey: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
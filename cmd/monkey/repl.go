@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/repl"
+)
+
+func runRepl(args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage: monkey repl\n\nStarts an interactive session, Tab completes names.\n")
+	}
+	flags.Parse(args)
+
+	if !isTerminal(os.Stdin) {
+		repl.Start(os.Stdin, os.Stdout, false)
+		return
+	}
+
+	restore, err := enableKeyInput()
+	if err != nil {
+		// Without key input the terminal still works, just without completion
+		repl.Start(os.Stdin, os.Stdout, false)
+		return
+	}
+	defer restore()
+
+	fmt.Println("Monkey REPL, press Ctrl-D to exit.")
+	repl.Start(os.Stdin, os.Stdout, true)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// enableKeyInput makes the terminal pass every key to the REPL without echoing
+// it. Ctrl-C becomes a key too, the REPL uses it to clear the line or to stop
+// a running evaluation. Output processing is left on, so newlines keep
+// working. The returned function restores the previous settings.
+func enableKeyInput() (func(), error) {
+	previous, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return nil, err
+	}
+
+	return func() { stty(strings.TrimSpace(previous)) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	return string(out), err
+}
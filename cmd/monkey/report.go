@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	diagnostic_severity "github.com/marcsek/monkey-language-server/internal/lsp/DiagnosticSeverity"
+)
+
+var reportWriters = map[string]func(io.Writer, []fileReport) error{
+	"human": writeHuman,
+	"json":  writeJSON,
+	"sarif": writeSARIF,
+}
+
+var severityNames = map[int]string{
+	diagnostic_severity.Error:       "error",
+	diagnostic_severity.Warning:     "warning",
+	diagnostic_severity.Information: "info",
+	diagnostic_severity.Hint:        "hint",
+}
+
+// writeHuman prints a line per diagnostic, positions are counted from 1 like
+// in editors.
+func writeHuman(out io.Writer, reports []fileReport) error {
+	problems, files := 0, 0
+
+	for _, report := range reports {
+		for _, d := range report.Diagnostics {
+			code := ""
+			if d.Code != "" {
+				code = fmt.Sprintf(" [%s]", d.Code)
+			}
+
+			_, err := fmt.Fprintf(
+				out,
+				"%s:%d:%d: %s: %s%s\n",
+				report.Path, d.Range.Start.Line+1, d.Range.Start.Character+1,
+				severityNames[d.Severity], d.Message, code,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(report.Diagnostics) != 0 {
+			problems += len(report.Diagnostics)
+			files++
+		}
+	}
+
+	if problems != 0 {
+		_, err := fmt.Fprintf(out, "\n%d problem(s) in %d file(s)\n", problems, files)
+		return err
+	}
+	return nil
+}
+
+// writeJSON prints the reports as they are, positions are counted from 0 like
+// in the protocol.
+func writeJSON(out io.Writer, reports []fileReport) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reports)
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name string `json:"name"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId,omitempty"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifRegion is counted from 1, columns are in UTF-16 code units like the
+// positions of the diagnostics, which is the default column kind of SARIF.
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+var sarifLevels = map[int]string{
+	diagnostic_severity.Error:       "error",
+	diagnostic_severity.Warning:     "warning",
+	diagnostic_severity.Information: "note",
+	diagnostic_severity.Hint:        "note",
+}
+
+// writeSARIF prints the reports as a SARIF 2.1.0 log, which code scanning
+// services can show on the lines of a change.
+func writeSARIF(out io.Writer, reports []fileReport) error {
+	results := []sarifResult{}
+
+	for _, report := range reports {
+		for _, d := range report.Diagnostics {
+			results = append(results, sarifResult{
+				RuleID:  d.Code,
+				Level:   sarifLevels[d.Severity],
+				Message: sarifMessage{Text: d.Message},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(report.Path)},
+						Region:           toSarifRegion(d.Range),
+					},
+				}},
+			})
+		}
+	}
+
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "monkey"}},
+			Results: results,
+		}},
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func toSarifRegion(r lsp.Range) sarifRegion {
+	return sarifRegion{
+		StartLine:   r.Start.Line + 1,
+		StartColumn: r.Start.Character + 1,
+		EndLine:     r.End.Line + 1,
+		EndColumn:   r.End.Character + 1,
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	diagnostic_severity "github.com/marcsek/monkey-language-server/internal/lsp/DiagnosticSeverity"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the reports")
+
+var testReports = []fileReport{
+	{
+		Path: "dir/a.monkey",
+		Diagnostics: []lsp.Diagnostic{
+			{
+				Range:    lspRange(0, 14, 0, 15),
+				Severity: diagnostic_severity.Error,
+				Code:     "undefined-variable",
+				Source:   "monkey-lsp",
+				Message:  "undefined variable x",
+			},
+			{
+				Range:    lspRange(1, 4, 1, 5),
+				Severity: diagnostic_severity.Warning,
+				Source:   "monkey-lsp",
+				Message:  "unused variable y",
+			},
+		},
+	},
+	{
+		Path:        "b.monkey",
+		Diagnostics: []lsp.Diagnostic{},
+	},
+}
+
+func TestReportWriters(t *testing.T) {
+	for format, write := range reportWriters {
+		var out bytes.Buffer
+		if err := write(&out, testReports); err != nil {
+			t.Fatalf("Unexpected error for %s: %s", format, err)
+		}
+
+		golden := filepath.Join("testdata", format+".golden")
+		if *update {
+			if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if out.String() != string(expected) {
+			t.Fatalf("Wrong %s report, want=%s; got=%s", format, expected, out.String())
+		}
+	}
+}
+
+func TestReportWritersWithoutProblems(t *testing.T) {
+	expected := map[string]string{
+		"human": "",
+		"json":  "[]\n",
+	}
+
+	for format, want := range expected {
+		var out bytes.Buffer
+		if err := reportWriters[format](&out, []fileReport{}); err != nil {
+			t.Fatalf("Unexpected error for %s: %s", format, err)
+		}
+
+		if out.String() != want {
+			t.Fatalf("Wrong %s report, want=%q; got=%q", format, want, out.String())
+		}
+	}
+}
+
+func lspRange(startLine, startCharacter, endLine, endCharacter int) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: startLine, Character: startCharacter},
+		End:   lsp.Position{Line: endLine, Character: endCharacter},
+	}
+}
@@ -0,0 +1,80 @@
+package analysis
+
+import (
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/DiagnosticSeverity"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+	"github.com/marcsek/monkey-language-server/internal/monkey/types"
+)
+
+const diagnosticSource = "monkey-lsp"
+
+const runtimeErrorCode = "runtime-error"
+
+func (d *Document) parserErrorsToDiagnostics(errors []parser.ParserError) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	for _, err := range errors {
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    d.toLspRange(err.Range),
+			Severity: diagnostic_severity.Error,
+			Code:     string(err.Code),
+			Source:   diagnosticSource,
+			Message:  err.Message,
+		})
+	}
+	return diagnostics
+}
+
+func (d *Document) compilerErrorsToDiagnostics(errors []compiler.CompilerError) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	for _, err := range errors {
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    d.toLspRange(err.Range),
+			Severity: diagnostic_severity.Error,
+			Code:     string(err.Code),
+			Source:   diagnosticSource,
+			Message:  err.Message,
+		})
+	}
+	return diagnostics
+}
+
+func (d *Document) typeErrorsToDiagnostics(errors []types.TypeError) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	for _, err := range errors {
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    d.toLspRange(err.Range),
+			Severity: diagnostic_severity.Error,
+			Code:     string(err.Code),
+			Source:   diagnosticSource,
+			Message:  err.Message,
+		})
+	}
+	return diagnostics
+}
+
+func (d *Document) runtimeErrorToDiagnostic(err *object.Error) lsp.Diagnostic {
+	return lsp.Diagnostic{
+		Range:    d.toLspRange(err.Range),
+		Severity: diagnostic_severity.Error,
+		Code:     runtimeErrorCode,
+		Source:   diagnosticSource,
+		Message:  err.Message,
+	}
+}
+
+// toLspRange converts a range of the lexer, which counts bytes, into the
+// UTF-16 code units of the protocol. Every range sent to the client goes
+// through it.
+func (d *Document) toLspRange(r token.Range) lsp.Range {
+	return d.lines.lspRange(d.Text, r)
+}
+
+// toTokenPosition converts a position from the client into the byte columns of
+// the lexer, before it's compared with ranges of the syntax tree.
+func (d *Document) toTokenPosition(position lsp.Position) token.Position {
+	return d.lines.tokenPosition(d.Text, position)
+}
@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+	"github.com/marcsek/monkey-language-server/internal/monkey/types"
+)
+
+// Document holds everything known about a single open text document. It's
+// rebuilt from scratch whenever the text changes.
+type Document struct {
+	URI         string
+	Text        string
+	Version     int
+	Program     *ast.Program
+	Compiler    *compiler.Compiler
+	Types       *types.Checker
+	Diagnostics []lsp.Diagnostic
+
+	lines lineIndex
+}
+
+// symbolAt returns the identifier under the cursor together with the symbol it
+// resolves to. The position is one of the lexer, see toTokenPosition.
+func (d *Document) symbolAt(position token.Position) (*ast.Identifier, compiler.Symbol, bool) {
+	ident := ast.IdentifierAt(d.Program, position)
+	if ident == nil {
+		return nil, compiler.Symbol{}, false
+	}
+
+	symbol, ok := d.Compiler.ResolveIdentifier(ident)
+	return ident, symbol, ok
+}
+
+// definitionOf returns the let statement that defines the symbol, or the
+// function literal if the symbol is one of its parameters.
+func (d *Document) definitionOf(symbol compiler.Symbol) ast.Node {
+	var definition ast.Node
+
+	ast.Inspect(d.Program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil && node.Name.Range() == symbol.Range {
+				definition = node
+			}
+
+		case *ast.FunctionLiteral:
+			for _, p := range node.Parameters {
+				if p.Range() == symbol.Range {
+					definition = node
+				}
+			}
+		}
+
+		return definition == nil
+	})
+
+	return definition
+}
@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/monkey/evaluator"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// Limits of a run, programs exceeding them stop with a runtime error.
+const (
+	runMaxSteps      = 10_000_000
+	runMaxDepth      = 1000
+	runMaxAllocation = 64 << 20
+	runTimeout       = 5 * time.Second
+)
+
+// CommandResult is the outcome of an executed command. Diagnostics are the
+// ones of the document with the runtime error added, so publishing them keeps
+// the others. They belong to the Version that was run, see WhileCurrent.
+type CommandResult struct {
+	Response    lsp.ExecuteCommandResponse
+	URI         string
+	Version     int
+	Diagnostics []lsp.Diagnostic
+}
+
+// ExecuteCommand runs the document, or its selection, in a sandboxed
+// evaluator. Output of puts is written to out while the program runs. The
+// result of the response is the value of the program, null when it failed.
+func (s *State) ExecuteCommand(
+	ctx context.Context,
+	id int,
+	command string,
+	arguments []json.RawMessage,
+	out io.Writer,
+) (CommandResult, error) {
+	result := CommandResult{
+		Response: lsp.ExecuteCommandResponse{
+			Response: lsp.Response{RPC: "2.0", ID: &id},
+		},
+	}
+
+	var uri string
+	var selection *lsp.Range
+
+	switch command {
+	case lsp.RunFileCommand:
+		if err := parseArguments(arguments, &uri); err != nil {
+			return result, err
+		}
+
+	case lsp.RunSelectionCommand:
+		selection = &lsp.Range{}
+		if err := parseArguments(arguments, &uri, selection); err != nil {
+			return result, err
+		}
+
+	default:
+		return result, fmt.Errorf("unknown command %s", command)
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok {
+		return result, fmt.Errorf("document %s is not open", uri)
+	}
+
+	text := document.Text
+	origin := token.Position{}
+	if selection != nil {
+		start := document.lines.offset(document.Text, selection.Start)
+		end := document.lines.offset(document.Text, selection.End)
+		if start > end {
+			return result, fmt.Errorf("invalid selection")
+		}
+
+		// Ranges of the selection are in bytes like the ones of the lexer
+		text = text[start:end]
+		origin = document.toTokenPosition(selection.Start)
+	}
+
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return result, fmt.Errorf("can't run code with syntax errors")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+
+	limits := evaluator.Limits{
+		MaxSteps:      runMaxSteps,
+		MaxDepth:      runMaxDepth,
+		MaxAllocation: runMaxAllocation,
+	}
+	value := evaluator.NewSandboxed(ctx, out, limits).Eval(program, object.NewEnvironment())
+
+	result.URI = uri
+	result.Version = document.Version
+	result.Diagnostics = append([]lsp.Diagnostic{}, document.Diagnostics...)
+
+	if err, ok := value.(*object.Error); ok {
+		err.Range = shiftRange(err.Range, origin)
+		result.Diagnostics = append(result.Diagnostics, document.runtimeErrorToDiagnostic(err))
+		return result, nil
+	}
+
+	if value != nil {
+		result.Response.Result = value.Inspect()
+	}
+
+	return result, nil
+}
+
+// parseArguments decodes the arguments into the targets in order.
+func parseArguments(arguments []json.RawMessage, targets ...any) error {
+	if len(arguments) < len(targets) {
+		return fmt.Errorf("expected %d arguments, got %d", len(targets), len(arguments))
+	}
+
+	for i, target := range targets {
+		if err := json.Unmarshal(arguments[i], target); err != nil {
+			return fmt.Errorf("invalid argument %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// shiftRange moves a range of a selection to the position the selection
+// starts at.
+func shiftRange(r token.Range, origin token.Position) token.Range {
+	return token.Range{Start: shiftPosition(r.Start, origin), End: shiftPosition(r.End, origin)}
+}
+
+func shiftPosition(p token.Position, origin token.Position) token.Position {
+	if p.Line == 0 {
+		p.Character += origin.Character
+	}
+	p.Line += origin.Line
+	return p
+}
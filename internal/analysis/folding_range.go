@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/FoldingRangeKind"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+func (s *State) FoldingRange(
+	ctx context.Context,
+	id int,
+	uri string,
+) lsp.FoldingRangeResponse {
+	response := lsp.FoldingRangeResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+		Result:   []lsp.FoldingRange{},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	response.Result = document.foldingRanges()
+	return response
+}
+
+// foldingRanges folds blocks, multi-line array and hash literals, and comments
+// spanning more lines. Brackets are folded up to the line before the closing
+// one, so it stays visible together with a following else.
+func (d *Document) foldingRanges() []lsp.FoldingRange {
+	ranges := []lsp.FoldingRange{}
+
+	ast.Inspect(d.Program, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.BlockStatement, *ast.ArrayLiteral, *ast.HashLiteral:
+			r := node.Range()
+			if r.End.Line-1 > r.Start.Line {
+				ranges = append(ranges, lsp.FoldingRange{StartLine: r.Start.Line, EndLine: r.End.Line - 1})
+			}
+		}
+		return true
+	})
+
+	for _, group := range d.commentGroups() {
+		start, end := group[0].Range.Start.Line, group[len(group)-1].Range.End.Line
+		if end > start {
+			ranges = append(ranges, lsp.FoldingRange{
+				StartLine: start,
+				EndLine:   end,
+				Kind:      folding_range_kind.Comment,
+			})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].StartLine < ranges[j].StartLine
+	})
+
+	return ranges
+}
+
+// commentGroups groups comments on their own lines that follow each other
+// without a blank line.
+func (d *Document) commentGroups() [][]token.Comment {
+	groups := [][]token.Comment{}
+
+	for _, comment := range d.Program.Comments {
+		// Columns of the lexer are bytes, so they index the line directly
+		lineStart := d.lines[comment.Range.Start.Line]
+		commentStart := lineStart + comment.Range.Start.Character
+		if strings.TrimSpace(d.Text[lineStart:commentStart]) != "" {
+			continue
+		}
+
+		if n := len(groups); n > 0 {
+			last := groups[n-1][len(groups[n-1])-1]
+			if last.Range.End.Line+1 == comment.Range.Start.Line {
+				groups[n-1] = append(groups[n-1], comment)
+				continue
+			}
+		}
+
+		groups = append(groups, []token.Comment{comment})
+	}
+
+	return groups
+}
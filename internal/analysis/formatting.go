@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"context"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/formatter"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// Formatting replaces the whole document with its formatted version. Documents
+// with syntax errors aren't formatted.
+func (s *State) Formatting(
+	ctx context.Context,
+	id int,
+	uri string,
+	options lsp.FormattingOptions,
+) lsp.DocumentFormattingResponse {
+	response := lsp.DocumentFormattingResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	formatted, err := formatter.Source(document.Text, formatterOptions(options))
+	if err != nil {
+		s.logger.Printf("Couldn't format %s: %s", uri, err)
+		return response
+	}
+
+	response.Result = []lsp.TextEdit{}
+	if formatted != document.Text {
+		response.Result = append(response.Result, lsp.TextEdit{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: 0, Character: 0},
+				End:   document.lines.end(document.Text),
+			},
+			NewText: formatted,
+		})
+	}
+
+	return response
+}
+
+// RangeFormatting formats top level statements that overlap the range.
+func (s *State) RangeFormatting(
+	ctx context.Context,
+	id int,
+	uri string,
+	rng lsp.Range,
+	options lsp.FormattingOptions,
+) lsp.DocumentFormattingResponse {
+	response := lsp.DocumentFormattingResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	p := parser.New(lexer.New(document.Text))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		s.logger.Printf("Couldn't format %s: %s", uri, p.Errors()[0])
+		return response
+	}
+
+	rangeStart := document.toTokenPosition(rng.Start)
+	rangeEnd := document.toTokenPosition(rng.End)
+
+	selected := []ast.Statement{}
+	for _, statement := range program.Statements {
+		statementRange := ast.FullRange(statement)
+		if !statementRange.End.Before(rangeStart) && !rangeEnd.Before(statementRange.Start) {
+			selected = append(selected, statement)
+		}
+	}
+
+	response.Result = []lsp.TextEdit{}
+	if len(selected) == 0 {
+		return response
+	}
+
+	// Comments around the statements are formatted with them
+	editRange := document.toLspRange(token.Range{
+		Start: ast.FullRange(selected[0]).Start,
+		End:   ast.FullRange(selected[len(selected)-1]).End,
+	})
+
+	formatted := formatter.Statements(selected, formatterOptions(options))
+	original := document.Text[document.lines.offset(document.Text, editRange.Start):document.lines.offset(document.Text, editRange.End)]
+
+	if formatted != original {
+		response.Result = append(response.Result, lsp.TextEdit{
+			Range:   editRange,
+			NewText: formatted,
+		})
+	}
+
+	return response
+}
+
+func formatterOptions(options lsp.FormattingOptions) formatter.Options {
+	result := formatter.DefaultOptions()
+	if options.TabSize > 0 {
+		result.IndentSize = options.TabSize
+	}
+	result.UseTabs = !options.InsertSpaces
+
+	return result
+}
@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/MarkupKind"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+	"github.com/marcsek/monkey-language-server/internal/monkey/types"
+)
+
+var scopeNames = map[compiler.SymbolScope]string{
+	compiler.GlobalScope:   "global",
+	compiler.LocalScope:    "local",
+	compiler.FreeScope:     "free",
+	compiler.FunctionScope: "function",
+	compiler.BuiltinScope:  "builtin",
+}
+
+func (s *State) Hover(
+	ctx context.Context,
+	id int,
+	uri string,
+	position lsp.Position,
+) lsp.HoverResponse {
+	response := lsp.HoverResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	ident, symbol, ok := document.symbolAt(document.toTokenPosition(position))
+	if !ok {
+		return response
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s**", symbol.Name)
+	if t := document.Types.TypeOfSymbol(symbol); t != types.Unknown {
+		fmt.Fprintf(&sb, ": `%s`", t)
+	}
+	fmt.Fprintf(&sb, " _(%s)_\n", scopeNames[symbol.Scope])
+
+	if symbol.Scope == compiler.BuiltinScope {
+		if docs, ok := object.BuiltinDocs[symbol.Name]; ok {
+			sb.WriteString("\n" + docs)
+		}
+	} else {
+		if definition := document.definitionSnippet(symbol); definition != "" {
+			fmt.Fprintf(&sb, "\n```monkey\n%s\n```", definition)
+		}
+
+		if let, ok := document.definitionOf(symbol).(*ast.LetStatement); ok {
+			if doc := docText(let.DocComment(let.Range().Start)); doc != "" {
+				sb.WriteString("\n\n" + doc)
+			}
+		}
+	}
+
+	rng := document.toLspRange(ident.Range())
+	response.Result = &lsp.HoverResult{
+		Contents: lsp.MarkupContent{
+			Kind:  markup_kind.Markdown,
+			Value: sb.String(),
+		},
+		Range: &rng,
+	}
+
+	return response
+}
+
+// definitionSnippet renders the let statement or the parameter list that
+// defines the symbol.
+func (d *Document) definitionSnippet(symbol compiler.Symbol) string {
+	switch node := d.definitionOf(symbol).(type) {
+	case *ast.LetStatement:
+		return node.String()
+
+	case *ast.FunctionLiteral:
+		params := []string{}
+		for _, p := range node.Parameters {
+			params = append(params, p.String())
+		}
+		return fmt.Sprintf("%s(%s)", node.TokenLiteral(), strings.Join(params, ", "))
+	}
+
+	return ""
+}
+
+// docText strips comment delimiters from the doc comment of a let statement.
+func docText(comments []token.Comment) string {
+	lines := []string{}
+
+	for _, c := range comments {
+		text := c.Text
+		switch {
+		case c.IsBlock():
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		case strings.HasPrefix(text, "//"):
+			text = strings.TrimPrefix(text, "//")
+		default:
+			text = strings.TrimPrefix(text, "#")
+		}
+
+		for _, line := range strings.Split(text, "\n") {
+			// Lines of block comments are often prefixed with a star
+			line = strings.TrimSpace(line)
+			if c.IsBlock() {
+				line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"context"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/DocumentHighlightKind"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+)
+
+func (s *State) References(
+	ctx context.Context,
+	id int,
+	uri string,
+	position lsp.Position,
+	includeDeclaration bool,
+) lsp.ReferencesResponse {
+	response := lsp.ReferencesResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+		Result:   []lsp.Location{},
+	}
+
+	document, references := s.referencesAt(ctx, uri, position)
+	for _, reference := range references {
+		if reference.IsDefinition && !includeDeclaration {
+			continue
+		}
+
+		response.Result = append(response.Result, lsp.Location{
+			URI:   uri,
+			Range: document.toLspRange(reference.Identifier.Range()),
+		})
+	}
+
+	return response
+}
+
+func (s *State) DocumentHighlight(
+	ctx context.Context,
+	id int,
+	uri string,
+	position lsp.Position,
+) lsp.DocumentHighlightResponse {
+	response := lsp.DocumentHighlightResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+		Result:   []lsp.DocumentHighlight{},
+	}
+
+	document, references := s.referencesAt(ctx, uri, position)
+	for _, reference := range references {
+		kind := document_highlight_kind.Read
+		if reference.IsDefinition {
+			kind = document_highlight_kind.Write
+		}
+
+		response.Result = append(response.Result, lsp.DocumentHighlight{
+			Range: document.toLspRange(reference.Identifier.Range()),
+			Kind:  kind,
+		})
+	}
+
+	return response
+}
+
+func (s *State) referencesAt(
+	ctx context.Context,
+	uri string,
+	position lsp.Position,
+) (*Document, []compiler.Reference) {
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return nil, nil
+	}
+
+	_, symbol, ok := document.symbolAt(document.toTokenPosition(position))
+	if !ok {
+		return nil, nil
+	}
+
+	return document, document.Compiler.References(symbol)
+}
@@ -0,0 +1,84 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+)
+
+// PrepareRename returns the range of the identifier under the cursor, or an
+// error when the identifier can't be renamed.
+func (s *State) PrepareRename(
+	ctx context.Context,
+	id int,
+	uri string,
+	position lsp.Position,
+) (lsp.PrepareRenameResponse, error) {
+	response := lsp.PrepareRenameResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response, nil
+	}
+
+	ident, symbol, ok := document.symbolAt(document.toTokenPosition(position))
+	if !ok {
+		return response, nil
+	}
+
+	if symbol.Scope == compiler.BuiltinScope {
+		return response, fmt.Errorf("builtin function %s can't be renamed", symbol.Name)
+	}
+
+	response.Result = &lsp.PrepareRenameResult{
+		Range:       document.toLspRange(ident.Range()),
+		Placeholder: ident.Value,
+	}
+
+	return response, nil
+}
+
+// Rename replaces every reference of the symbol under the cursor with newName.
+func (s *State) Rename(
+	ctx context.Context,
+	id int,
+	uri string,
+	position lsp.Position,
+	newName string,
+) (lsp.RenameResponse, error) {
+	response := lsp.RenameResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response, nil
+	}
+
+	_, symbol, ok := document.symbolAt(document.toTokenPosition(position))
+	if !ok {
+		return response, nil
+	}
+
+	if err := document.Compiler.ValidateRename(symbol, newName); err != nil {
+		return response, err
+	}
+
+	edits := []lsp.TextEdit{}
+	for _, reference := range document.Compiler.References(symbol) {
+		edits = append(edits, lsp.TextEdit{
+			Range:   document.toLspRange(reference.Identifier.Range()),
+			NewText: newName,
+		})
+	}
+
+	response.Result = &lsp.WorkspaceEdit{
+		Changes: map[string][]lsp.TextEdit{uri: edits},
+	}
+
+	return response, nil
+}
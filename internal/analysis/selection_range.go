@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"context"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+func (s *State) SelectionRange(
+	ctx context.Context,
+	id int,
+	uri string,
+	positions []lsp.Position,
+) lsp.SelectionRangeResponse {
+	response := lsp.SelectionRangeResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+		Result:   []lsp.SelectionRange{},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	for _, position := range positions {
+		response.Result = append(response.Result, document.selectionRange(document.toTokenPosition(position)))
+	}
+
+	return response
+}
+
+// selectionRange nests ranges of the nodes containing the position, from the
+// innermost one up to the whole program. Nodes with the same range as their
+// parent are skipped, so every step expands the selection.
+func (d *Document) selectionRange(position token.Position) lsp.SelectionRange {
+	var current *lsp.SelectionRange
+
+	for node := ast.Node(d.Program); node != nil; {
+		r := d.toLspRange(ast.Span(node))
+		if current == nil || current.Range != r {
+			current = &lsp.SelectionRange{Range: r, Parent: current}
+		}
+
+		var next ast.Node
+		for _, child := range ast.Children(node) {
+			if ast.Span(child).Contains(position) {
+				next = child
+				break
+			}
+		}
+		node = next
+	}
+
+	return *current
+}
@@ -0,0 +1,287 @@
+package analysis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/SemanticTokenModifiers"
+	"github.com/marcsek/monkey-language-server/internal/lsp/SemanticTokenTypes"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+var (
+	semanticTokenTypes     = legendIndex(lsp.SemanticTokensLegend.TokenTypes)
+	semanticTokenModifiers = legendIndex(lsp.SemanticTokensLegend.TokenModifiers)
+)
+
+var scopeModifiers = map[compiler.SymbolScope]string{
+	compiler.GlobalScope: semantic_token_modifiers.Global,
+	compiler.LocalScope:  semantic_token_modifiers.Local,
+	compiler.FreeScope:   semantic_token_modifiers.Captured,
+}
+
+var keywordTokens = map[token.TokenType]bool{
+	token.FUNCTION: true,
+	token.LET:      true,
+	token.TRUE:     true,
+	token.FALSE:    true,
+	token.IF:       true,
+	token.ELSE:     true,
+	token.RETURN:   true,
+}
+
+var operatorTokens = map[token.TokenType]bool{
+	token.ASSIGN:   true,
+	token.PLUS:     true,
+	token.MINUS:    true,
+	token.BANG:     true,
+	token.ASTERISK: true,
+	token.SLASH:    true,
+	token.LT:       true,
+	token.GT:       true,
+	token.EQ:       true,
+	token.NOT_EQ:   true,
+}
+
+// semanticTokensResult is the last result sent for a document, deltas are
+// computed against it.
+type semanticTokensResult struct {
+	id   string
+	data []uint32
+}
+
+func legendIndex(names []string) map[string]uint32 {
+	index := map[string]uint32{}
+	for i, name := range names {
+		index[name] = uint32(i)
+	}
+	return index
+}
+
+func (s *State) SemanticTokensFull(
+	ctx context.Context,
+	id int,
+	uri string,
+) lsp.SemanticTokensResponse {
+	response := lsp.SemanticTokensResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	data := document.semanticTokens()
+	response.Result = &lsp.SemanticTokens{
+		ResultID: s.storeSemanticTokens(uri, data),
+		Data:     data,
+	}
+
+	return response
+}
+
+func (s *State) SemanticTokensDelta(
+	ctx context.Context,
+	id int,
+	uri string,
+	previousResultID string,
+) lsp.SemanticTokensDeltaResponse {
+	response := lsp.SemanticTokensDeltaResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	s.semanticTokensMu.Lock()
+	previous, hasPrevious := s.semanticTokens[uri]
+	s.semanticTokensMu.Unlock()
+
+	data := document.semanticTokens()
+	resultID := s.storeSemanticTokens(uri, data)
+
+	if !hasPrevious || previous.id != previousResultID {
+		response.Result = lsp.SemanticTokens{ResultID: resultID, Data: data}
+		return response
+	}
+
+	response.Result = lsp.SemanticTokensDelta{
+		ResultID: resultID,
+		Edits:    semanticTokensEdits(previous.data, data),
+	}
+
+	return response
+}
+
+func (s *State) storeSemanticTokens(uri string, data []uint32) string {
+	s.semanticTokensMu.Lock()
+	defer s.semanticTokensMu.Unlock()
+
+	s.semanticTokensResultID++
+	id := strconv.Itoa(s.semanticTokensResultID)
+	s.semanticTokens[uri] = semanticTokensResult{id: id, data: data}
+
+	return id
+}
+
+// semanticTokensEdits replaces the part between the common prefix and suffix
+// with a single edit.
+func semanticTokensEdits(previous, current []uint32) []lsp.SemanticTokensEdit {
+	prefix := 0
+	for prefix < len(previous) && prefix < len(current) && previous[prefix] == current[prefix] {
+		prefix++
+	}
+
+	if prefix == len(previous) && prefix == len(current) {
+		return []lsp.SemanticTokensEdit{}
+	}
+
+	suffix := 0
+	for suffix < len(previous)-prefix && suffix < len(current)-prefix &&
+		previous[len(previous)-1-suffix] == current[len(current)-1-suffix] {
+		suffix++
+	}
+
+	return []lsp.SemanticTokensEdit{{
+		Start:       prefix,
+		DeleteCount: len(previous) - prefix - suffix,
+		Data:        current[prefix : len(current)-suffix],
+	}}
+}
+
+// semanticTokens classifies tokens of the text and encodes them relative to
+// the previous token, five integers per token.
+func (d *Document) semanticTokens() []uint32 {
+	identifiers := map[token.Position]*ast.Identifier{}
+	functions := map[token.Range]bool{}
+	parameters := map[token.Range]bool{}
+
+	ast.Inspect(d.Program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			identifiers[node.Range().Start] = node
+
+		case *ast.LetStatement:
+			if _, ok := node.Value.(*ast.FunctionLiteral); ok && node.Name != nil {
+				functions[node.Name.Range()] = true
+			}
+
+		case *ast.FunctionLiteral:
+			for _, p := range node.Parameters {
+				parameters[p.Range()] = true
+			}
+		}
+		return true
+	})
+
+	data := []uint32{}
+	previous := lsp.Position{}
+
+	add := func(tokenRange token.Range, tokenType string, modifiers []string) {
+		var modifierBits uint32
+		for _, modifier := range modifiers {
+			modifierBits |= 1 << semanticTokenModifiers[modifier]
+		}
+
+		rng := d.toLspRange(tokenRange)
+
+		character := rng.Start.Character
+		if rng.Start.Line == previous.Line {
+			character -= previous.Character
+		}
+
+		data = append(data,
+			uint32(rng.Start.Line-previous.Line),
+			uint32(character),
+			uint32(rng.End.Character-rng.Start.Character),
+			semanticTokenTypes[tokenType],
+			modifierBits,
+		)
+		previous = rng.Start
+	}
+
+	// Tokens can't span lines, multi-line block comments are left out
+	addComments := func(comments []token.Comment) {
+		for _, c := range comments {
+			if c.Range.Start.Line == c.Range.End.Line {
+				add(c.Range, semantic_token_types.Comment, nil)
+			}
+		}
+	}
+
+	l := lexer.New(d.Text)
+	for {
+		tok := l.NextToken()
+		addComments(tok.Leading)
+		if tok.Type == token.EOF {
+			break
+		}
+
+		var tokenType string
+		var modifiers []string
+
+		switch {
+		case tok.Type == token.IDENT:
+			tokenType, modifiers = d.classifyIdentifier(identifiers[tok.Range.Start], functions, parameters)
+		case keywordTokens[tok.Type]:
+			tokenType = semantic_token_types.Keyword
+		case operatorTokens[tok.Type]:
+			tokenType = semantic_token_types.Operator
+		case tok.Type == token.INT:
+			tokenType = semantic_token_types.Number
+		case tok.Type == token.STRING && !strings.Contains(tok.Literal, "\n"):
+			tokenType = semantic_token_types.String
+		}
+
+		if tokenType != "" {
+			add(tok.Range, tokenType, modifiers)
+		}
+		addComments(tok.Trailing)
+	}
+
+	return data
+}
+
+func (d *Document) classifyIdentifier(
+	ident *ast.Identifier,
+	functions, parameters map[token.Range]bool,
+) (string, []string) {
+	if ident == nil {
+		return semantic_token_types.Variable, nil
+	}
+
+	symbol, ok := d.Compiler.ResolveIdentifier(ident)
+	if !ok {
+		return semantic_token_types.Variable, nil
+	}
+
+	if symbol.Scope == compiler.BuiltinScope {
+		return semantic_token_types.Function, []string{semantic_token_modifiers.DefaultLibrary}
+	}
+
+	// Monkey has no assignment, every binding is readonly
+	modifiers := []string{semantic_token_modifiers.Readonly}
+	if ident.Range() == symbol.Range {
+		modifiers = append(modifiers, semantic_token_modifiers.Declaration)
+	}
+	if modifier, ok := scopeModifiers[symbol.Scope]; ok {
+		modifiers = append(modifiers, modifier)
+	}
+
+	switch {
+	case symbol.Scope == compiler.FunctionScope || functions[symbol.Range]:
+		return semantic_token_types.Function, modifiers
+	case parameters[symbol.Range]:
+		return semantic_token_types.Parameter, modifiers
+	}
+
+	return semantic_token_types.Variable, modifiers
+}
@@ -0,0 +1,216 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/MarkupKind"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+	"github.com/marcsek/monkey-language-server/internal/monkey/types"
+)
+
+// openCall is a call whose argument list isn't closed before the cursor.
+type openCall struct {
+	callee   token.Token
+	argument int
+}
+
+// bracket is an opening token that wasn't closed yet.
+type bracket struct {
+	token  token.Token
+	callee *token.Token
+	commas int
+
+	// barrier stops the search for the enclosing call, the cursor is in a
+	// function body or a parameter list
+	barrier bool
+}
+
+var closingBrackets = map[token.TokenType]token.TokenType{
+	token.RPAREN:   token.LPAREN,
+	token.RBRACKET: token.LBRACKET,
+	token.RBRACE:   token.LBRACE,
+}
+
+// findOpenCall scans tokens before the position, so it works on calls that
+// are still being typed and don't parse yet.
+func findOpenCall(text string, position token.Position) (openCall, bool) {
+	stack := []bracket{}
+	previous := token.Token{}
+
+	l := lexer.New(text)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if !tok.Range.Start.Before(position) {
+			break
+		}
+
+		switch tok.Type {
+		case token.LPAREN:
+			open := bracket{token: tok, barrier: previous.Type == token.FUNCTION}
+			if previous.Type == token.IDENT {
+				callee := previous
+				open.callee = &callee
+			}
+			stack = append(stack, open)
+
+		case token.LBRACKET:
+			stack = append(stack, bracket{token: tok})
+
+		case token.LBRACE:
+			stack = append(stack, bracket{token: tok, barrier: true})
+
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			// Unbalanced brackets close everything up to the matching one
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].token.Type == closingBrackets[tok.Type] {
+					stack = stack[:i]
+					break
+				}
+			}
+
+		case token.COMMA:
+			if len(stack) > 0 {
+				stack[len(stack)-1].commas++
+			}
+		}
+
+		previous = tok
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		open := stack[i]
+		if open.barrier {
+			break
+		}
+
+		if open.callee != nil {
+			return openCall{callee: *open.callee, argument: open.commas}, true
+		}
+	}
+
+	return openCall{}, false
+}
+
+func (s *State) SignatureHelp(
+	ctx context.Context,
+	id int,
+	uri string,
+	position lsp.Position,
+) lsp.SignatureHelpResponse {
+	response := lsp.SignatureHelpResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	cursor := document.toTokenPosition(position)
+
+	call, ok := findOpenCall(document.Text, cursor)
+	if !ok {
+		return response
+	}
+
+	symbol, ok := document.calleeSymbol(call.callee, cursor)
+	if !ok {
+		return response
+	}
+
+	var params []string
+	var documentation *lsp.MarkupContent
+
+	if symbol.Scope == compiler.BuiltinScope {
+		params = object.BuiltinParameters[symbol.Name]
+		documentation = &lsp.MarkupContent{
+			Kind:  markup_kind.Markdown,
+			Value: object.BuiltinDocs[symbol.Name],
+		}
+	} else {
+		let, ok := document.definitionOf(symbol).(*ast.LetStatement)
+		if !ok {
+			return response
+		}
+
+		literal, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok {
+			return response
+		}
+
+		for _, p := range literal.Parameters {
+			params = append(params, p.Value)
+		}
+
+		if t := document.Types.TypeOfSymbol(symbol); t != types.Unknown {
+			documentation = &lsp.MarkupContent{
+				Kind:  markup_kind.Markdown,
+				Value: fmt.Sprintf("```monkey\n%s\n```", t),
+			}
+		}
+	}
+
+	signature := newSignatureInformation(symbol.Name, params)
+	signature.Documentation = documentation
+
+	active := call.argument
+	if n := len(params); n > 0 && active >= n && strings.HasSuffix(params[n-1], "...") {
+		active = n - 1
+	}
+
+	response.Result = &lsp.SignatureHelp{
+		Signatures:      []lsp.SignatureInformation{signature},
+		ActiveSignature: 0,
+		ActiveParameter: active,
+	}
+
+	return response
+}
+
+// calleeSymbol resolves the callee through the syntax tree. When the call
+// didn't parse, the callee is looked up by name in the scope of the position.
+func (d *Document) calleeSymbol(callee token.Token, position token.Position) (compiler.Symbol, bool) {
+	ident, symbol, ok := d.symbolAt(callee.Range.Start)
+	if ok && ident.Value == callee.Literal {
+		return symbol, true
+	}
+
+	for _, symbol := range d.Compiler.VisibleSymbols(position) {
+		if symbol.Name == callee.Literal {
+			return symbol, true
+		}
+	}
+
+	return compiler.Symbol{}, false
+}
+
+func newSignatureInformation(name string, params []string) lsp.SignatureInformation {
+	var label strings.Builder
+	parameters := []lsp.ParameterInformation{}
+
+	label.WriteString(name + "(")
+	for i, p := range params {
+		if i > 0 {
+			label.WriteString(", ")
+		}
+
+		// Identifiers are ASCII, so byte offsets are the same as UTF-16 ones
+		start := label.Len()
+		label.WriteString(p)
+		parameters = append(parameters, lsp.ParameterInformation{
+			Label: [2]int{start, label.Len()},
+		})
+	}
+	label.WriteString(")")
+
+	return lsp.SignatureInformation{
+		Label:      label.String(),
+		Parameters: parameters,
+	}
+}
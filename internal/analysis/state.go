@@ -1,143 +1,239 @@
 package analysis
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/marcsek/monkey-language-server/internal/lsp"
 	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
 	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
 	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
-	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+	"github.com/marcsek/monkey-language-server/internal/monkey/types"
 )
 
+// State is safe for concurrent use. Documents are never modified after they
+// are analyzed, a change replaces the whole document instead.
 type State struct {
-	Documents map[string]string
-	Compiler  *compiler.Compiler
+	Documents map[string]*Document
 	logger    *log.Logger
+
+	mu sync.RWMutex
+
+	semanticTokens         map[string]semanticTokensResult
+	semanticTokensResultID int
+	semanticTokensMu       sync.Mutex
 }
 
 func NewState(logger *log.Logger) *State {
-	return &State{Documents: map[string]string{}, logger: logger}
+	return &State{
+		Documents:      map[string]*Document{},
+		logger:         logger,
+		semanticTokens: map[string]semanticTokensResult{},
+	}
 }
 
-func (s *State) createCompiler(text string) *compiler.Compiler {
-	//constants := []object.Object{}
-	//globals := make([]object.Object, vm.GlobalsSize)
+func (s *State) analyzeDocument(uri, text string, version int) *Document {
+	document := Analyze(text, s.logger)
+	document.URI = uri
+	document.Version = version
+	return document
+}
 
+// Analyze runs the lexer, parser, compiler and type checker on the text. It's
+// shared with the command line tools, so they report the same diagnostics as
+// the server.
+func Analyze(text string, logger *log.Logger) *Document {
 	start := time.Now()
 
-	//for i, name := range object.Builtins {
-	//	symbolTable.DefineBuiltin(i, name)
-	//}
+	document := &Document{Text: text, lines: newLineIndex(text)}
 
 	l := lexer.New(text)
 	p := parser.New(l)
 
 	program := p.ParseProgram()
 
-	if len(p.Errors()) != 0 {
-		s.logger.Printf("Parser Errors: %v", p.Errors())
-	}
+	diagnostics := document.parserErrorsToDiagnostics(p.Errors())
 
-	comp := compiler.New(s.logger)
+	comp := compiler.New(logger)
 
 	err := comp.Compile(program)
 	if err != nil {
-		s.logger.Printf("Compilation error: %s", err)
+		logger.Printf("Compilation error: %s", err)
 	}
+	diagnostics = append(diagnostics, document.compilerErrorsToDiagnostics(comp.Errors())...)
+
+	checker := types.Check(program, comp)
+	diagnostics = append(diagnostics, document.typeErrorsToDiagnostics(checker.Errors())...)
+
 	total := time.Since(start)
 
-	s.logger.Printf("Compile time: %s", total)
-	_ = program
+	logger.Printf("Compile time: %s", total)
 
-	return comp
+	document.Program = program
+	document.Compiler = comp
+	document.Types = checker
+	document.Diagnostics = diagnostics
+	return document
 }
 
-func (s *State) OpenDocument(uri, text string) []lsp.Diagnostic {
-	s.Documents[uri] = text
-	s.Compiler = s.createCompiler(text)
+type snapshotKey struct{}
+
+// Snapshot returns a context holding the documents as they are now. Requests
+// handled with it keep seeing these documents when they change meanwhile.
+func (s *State) Snapshot(ctx context.Context) context.Context {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	documents := make(map[string]*Document, len(s.Documents))
+	for uri, document := range s.Documents {
+		documents[uri] = document
+	}
 
-	return getDiagnosticsForFile(text)
+	return context.WithValue(ctx, snapshotKey{}, documents)
 }
 
-func (s *State) UpdateDocument(uri, text string) []lsp.Diagnostic {
-	s.Documents[uri] = text
-	s.Compiler = s.createCompiler(text)
+// getDocument prefers the snapshot of the context over the current documents.
+func (s *State) getDocument(ctx context.Context, uri string) (*Document, bool) {
+	if documents, ok := ctx.Value(snapshotKey{}).(map[string]*Document); ok {
+		document, ok := documents[uri]
+		return document, ok
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return getDiagnosticsForFile(text)
+	document, ok := s.Documents[uri]
+	return document, ok
 }
 
-func (s *State) Hover(id int, uri string, position lsp.Position) lsp.HoverResponse {
+func (s *State) OpenDocument(uri, text string, version int) []lsp.Diagnostic {
+	document := s.analyzeDocument(uri, text, version)
 
-	document := s.Documents[uri]
+	s.mu.Lock()
+	s.Documents[uri] = document
+	s.mu.Unlock()
 
-	response := lsp.HoverResponse{
-		Response: lsp.Response{
-			RPC: "2.0",
-			ID:  &id,
-		},
-		Result: lsp.HoverResult{
-			Contents: fmt.Sprintf("File %s, Characters: %d", uri, len(document)),
-		},
+	return document.Diagnostics
+}
+
+// UpdateDocument applies content changes in order and reanalyzes the result.
+// Changes for unknown documents or with a version that isn't newer than the
+// stored one are rejected.
+func (s *State) UpdateDocument(
+	uri string,
+	version int,
+	changes []lsp.TextDocumentContentChangeEvent,
+) ([]lsp.Diagnostic, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document, ok := s.Documents[uri]
+	if !ok {
+		return nil, fmt.Errorf("document %s is not open", uri)
 	}
 
-	return response
+	if version <= document.Version {
+		return nil, fmt.Errorf(
+			"stale change for %s (version %d, current %d)",
+			uri,
+			version,
+			document.Version,
+		)
+	}
+
+	text := document.Text
+	lines := document.lines
+	for _, change := range changes {
+		var err error
+		text, err = applyContentChange(text, lines, change)
+		if err != nil {
+			return nil, err
+		}
+		lines = newLineIndex(text)
+	}
+
+	document = s.analyzeDocument(uri, text, version)
+	s.Documents[uri] = document
+
+	return document.Diagnostics, nil
+}
+
+// WhileCurrent calls fn when the document is still open at the version and
+// reports whether it did. Changes wait until fn returns, so a notification it
+// sends can't arrive after one about a newer version.
+func (s *State) WhileCurrent(uri string, version int, fn func()) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	document, ok := s.Documents[uri]
+	if !ok || document.Version != version {
+		return false
+	}
+
+	fn()
+	return true
+}
+
+func (s *State) CloseDocument(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Documents, uri)
+
+	s.semanticTokensMu.Lock()
+	delete(s.semanticTokens, uri)
+	s.semanticTokensMu.Unlock()
 }
 
-func (s *State) Definition(id int, uri string, position lsp.Position) lsp.DefinitionResponse {
+func (s *State) Definition(
+	ctx context.Context,
+	id int,
+	uri string,
+	position lsp.Position,
+) lsp.DefinitionResponse {
 	response := lsp.DefinitionResponse{
 		Response: lsp.Response{RPC: "2.0", ID: &id},
-		Result: lsp.Location{
-			URI: uri,
-			Range: lsp.Range{
-				Start: lsp.Position{
-					Line:      position.Line + 1,
-					Character: 0,
-				},
-				End: lsp.Position{
-					Line:      position.Line + 1,
-					Character: 0,
-				},
-			},
-		},
+		Result:   nil,
 	}
 
-	return response
-}
+	document, ok := s.getDocument(ctx, uri)
+	if !ok {
+		return response
+	}
 
-func getDiagnosticsForFile(text string) []lsp.Diagnostic {
-	diagnostics := []lsp.Diagnostic{}
-	for row, line := range strings.Split(text, "\n") {
-		idx := strings.Index(line, "VS Code")
-		if idx >= 0 {
-			diagnostics = append(diagnostics, lsp.Diagnostic{
-				Range: lsp.Range{
-					Start: lsp.Position{
-						Line:      row,
-						Character: idx,
-					},
-					End: lsp.Position{
-						Line:      row,
-						Character: idx + len("VS Code"),
-					},
-				},
-				Severity: 1,
-				Source:   "The god him self",
-				Message:  "Fix this asap",
-			})
-		}
+	_, symbol, ok := document.symbolAt(document.toTokenPosition(position))
+	if !ok || symbol.Scope == compiler.BuiltinScope {
+		return response
 	}
-	return diagnostics
+
+	response.Result = &lsp.Location{
+		URI:   uri,
+		Range: document.toLspRange(symbol.Range),
+	}
+
+	return response
 }
 
-func (s *State) TextDocumentCodeAction(id int, uri string) lsp.CodeActionResponse {
-	text := s.Documents[uri]
+func (s *State) TextDocumentCodeAction(
+	ctx context.Context,
+	id int,
+	uri string,
+) lsp.CodeActionResponse {
+	text := ""
+	if document, ok := s.getDocument(ctx, uri); ok {
+		text = document.Text
+	}
 
 	actions := []lsp.CodeAction{}
 	for row, line := range strings.Split(text, "\n") {
+		if ctx.Err() != nil {
+			break
+		}
+
 		idx := strings.Index(line, "VS Code")
 		if idx >= 0 {
 			replaceChange := map[string][]lsp.TextEdit{}
@@ -176,11 +272,32 @@ func (s *State) TextDocumentCodeAction(id int, uri string) lsp.CodeActionRespons
 }
 
 func (s *State) TextDocumentCompletion(
+	ctx context.Context,
 	id int,
 	position lsp.Position,
 	uri string,
 ) lsp.CompletionResponse {
-	items := s.Compiler.Completion(token.Position(position))
+	items := []lsp.CompletionItem{}
+	if document, ok := s.getDocument(ctx, uri); ok && ctx.Err() == nil {
+		cursor := document.toTokenPosition(position)
+		items = document.Compiler.Completion(cursor)
+
+		symbols := map[string]compiler.Symbol{}
+		for _, symbol := range document.Compiler.VisibleSymbols(cursor) {
+			symbols[symbol.Name] = symbol
+		}
+
+		for i, item := range items {
+			symbol, ok := symbols[item.Label]
+			if !ok {
+				continue
+			}
+
+			if t := document.Types.TypeOfSymbol(symbol); t != types.Unknown {
+				items[i].Detail = t.String()
+			}
+		}
+	}
 
 	return lsp.CompletionResponse{
 		Response: lsp.Response{
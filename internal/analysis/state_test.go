@@ -0,0 +1,733 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/DocumentHighlightKind"
+	"github.com/marcsek/monkey-language-server/internal/lsp/MarkupKind"
+	"github.com/marcsek/monkey-language-server/internal/lsp/SymbolKind"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+)
+
+var (
+	buff       bytes.Buffer
+	MockLogger = log.New(&buff, "", log.LstdFlags)
+)
+
+func TestDocumentsAreIsolated(t *testing.T) {
+	state := NewState(MockLogger)
+
+	state.OpenDocument("file:///a.monkey", "let onlyInA = 1;", 1)
+	state.OpenDocument("file:///b.monkey", "let onlyInB = 2;\nonlyInA;", 1)
+
+	tests := []struct {
+		uri      string
+		expected string
+		missing  string
+	}{
+		{"file:///a.monkey", "onlyInA", "onlyInB"},
+		{"file:///b.monkey", "onlyInB", "onlyInA"},
+	}
+
+	for _, tt := range tests {
+		response := state.TextDocumentCompletion(
+			context.Background(),
+			1,
+			lsp.Position{Line: 0, Character: 0},
+			tt.uri,
+		)
+
+		if !hasCompletionLabel(response.Result, tt.expected) {
+			t.Fatalf("Completion for %s should contain %s", tt.uri, tt.expected)
+		}
+
+		if hasCompletionLabel(response.Result, tt.missing) {
+			t.Fatalf("Completion for %s should not contain %s", tt.uri, tt.missing)
+		}
+	}
+
+	if len(state.Documents["file:///a.monkey"].Diagnostics) != 0 {
+		t.Fatalf("Document a.monkey should not have diagnostics")
+	}
+
+	if len(state.Documents["file:///b.monkey"].Diagnostics) != 1 {
+		t.Fatalf("Document b.monkey should have 1 diagnostic")
+	}
+}
+
+func hasCompletionLabel(items []lsp.CompletionItem, label string) bool {
+	for _, item := range items {
+		if item.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDefinition(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "let value = 1;\nlet f = fn(value) { value };\nlen(value);", 1)
+
+	tests := []struct {
+		position lsp.Position
+		expected *lsp.Range
+	}{
+		{lsp.Position{Line: 1, Character: 22}, &lsp.Range{
+			Start: lsp.Position{Line: 1, Character: 11},
+			End:   lsp.Position{Line: 1, Character: 16},
+		}},
+		{lsp.Position{Line: 2, Character: 6}, &lsp.Range{
+			Start: lsp.Position{Line: 0, Character: 4},
+			End:   lsp.Position{Line: 0, Character: 9},
+		}},
+		{lsp.Position{Line: 2, Character: 1}, nil},
+		{lsp.Position{Line: 1, Character: 5}, &lsp.Range{
+			Start: lsp.Position{Line: 1, Character: 4},
+			End:   lsp.Position{Line: 1, Character: 5},
+		}},
+	}
+
+	for _, tt := range tests {
+		response := state.Definition(context.Background(), 1, uri, tt.position)
+
+		if tt.expected == nil {
+			if response.Result != nil {
+				t.Fatalf("Expected no definition at %v, got=%v", tt.position, response.Result)
+			}
+			continue
+		}
+
+		if response.Result == nil {
+			t.Fatalf("Expected definition at %v, got none", tt.position)
+		}
+
+		if response.Result.Range != *tt.expected {
+			t.Fatalf("Wrong definition at %v, want=%v; got=%v",
+				tt.position, *tt.expected, response.Result.Range)
+		}
+	}
+}
+
+func TestDefinitionAfterMultiByteString(t *testing.T) {
+	state := NewState(MockLogger)
+
+	tests := []struct {
+		text     string
+		position lsp.Position
+	}{
+		{`let s = "é"; let y = s;`, lsp.Position{Line: 0, Character: 21}},
+		{`let s = "😀"; s`, lsp.Position{Line: 0, Character: 14}},
+	}
+
+	expected := lsp.Range{
+		Start: lsp.Position{Line: 0, Character: 4},
+		End:   lsp.Position{Line: 0, Character: 5},
+	}
+
+	for _, tt := range tests {
+		uri := "file:///multibyte.monkey"
+		state.OpenDocument(uri, tt.text, 1)
+
+		response := state.Definition(context.Background(), 1, uri, tt.position)
+		if response.Result == nil {
+			t.Fatalf("Expected definition at %v in %q, got none", tt.position, tt.text)
+		}
+
+		if response.Result.Range != expected {
+			t.Fatalf("Wrong definition in %q, want=%v; got=%v", tt.text, expected, response.Result.Range)
+		}
+	}
+}
+
+func TestReferencesAndHighlights(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "let a = 1;\nlet b = fn(a) { a };\na + b(a);", 1)
+
+	position := lsp.Position{Line: 2, Character: 0}
+
+	references := state.References(context.Background(), 1, uri, position, false)
+	if len(references.Result) != 2 {
+		t.Fatalf("Wrong number of references, want=2; got=%d", len(references.Result))
+	}
+
+	references = state.References(context.Background(), 1, uri, position, true)
+	if len(references.Result) != 3 {
+		t.Fatalf("Wrong number of references with declaration, want=3; got=%d", len(references.Result))
+	}
+
+	highlights := state.DocumentHighlight(context.Background(), 1, uri, position)
+	expectedKinds := []int{document_highlight_kind.Write, document_highlight_kind.Read, document_highlight_kind.Read}
+	if len(highlights.Result) != len(expectedKinds) {
+		t.Fatalf("Wrong number of highlights, want=%d; got=%d", len(expectedKinds), len(highlights.Result))
+	}
+
+	for i, kind := range expectedKinds {
+		if highlights.Result[i].Kind != kind {
+			t.Fatalf("Wrong highlight kind, want=%d; got=%d", kind, highlights.Result[i].Kind)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "let a = 1;\nlet f = fn() { let a = 2; fn() { a } };\na;", 1)
+
+	prepare, err := state.PrepareRename(context.Background(), 1, uri, lsp.Position{Line: 1, Character: 19})
+	if err != nil || prepare.Result == nil {
+		t.Fatalf("Prepare rename failed: %v", err)
+	}
+	if prepare.Result.Placeholder != "a" {
+		t.Fatalf("Wrong placeholder, want=a; got=%s", prepare.Result.Placeholder)
+	}
+
+	rename, err := state.Rename(context.Background(), 1, uri, lsp.Position{Line: 1, Character: 19}, "b")
+	if err != nil {
+		t.Fatalf("Rename failed: %s", err)
+	}
+
+	expected := []lsp.Range{
+		{Start: lsp.Position{Line: 1, Character: 19}, End: lsp.Position{Line: 1, Character: 20}},
+		{Start: lsp.Position{Line: 1, Character: 33}, End: lsp.Position{Line: 1, Character: 34}},
+	}
+
+	edits := rename.Result.Changes[uri]
+	if len(edits) != len(expected) {
+		t.Fatalf("Wrong number of edits, want=%d; got=%d", len(expected), len(edits))
+	}
+
+	for i, rng := range expected {
+		if edits[i].Range != rng || edits[i].NewText != "b" {
+			t.Fatalf("Wrong edit, want=%v; got=%v", rng, edits[i])
+		}
+	}
+
+	if _, err := state.Rename(context.Background(), 1, uri, lsp.Position{Line: 2, Character: 0}, "f"); err == nil {
+		t.Fatalf("Rename to an existing name should fail")
+	}
+
+	state.OpenDocument(uri, "len([]);", 2)
+	if _, err := state.PrepareRename(context.Background(), 1, uri, lsp.Position{Line: 0, Character: 1}); err == nil {
+		t.Fatalf("Prepare rename of a builtin should fail")
+	}
+}
+
+func TestHover(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "let a = 1;\nlet f = fn(x, y) { a + x };\nlen(f);", 1)
+
+	tests := []struct {
+		position lsp.Position
+		expected string
+	}{
+		{lsp.Position{Line: 0, Character: 4}, "**a**: `int` _(global)_\n\n```monkey\nlet a = 1;\n```"},
+		{lsp.Position{Line: 1, Character: 23}, "**x** _(local)_\n\n```monkey\nfn(x, y)\n```"},
+		{lsp.Position{Line: 2, Character: 1}, "**len**: `fn(unknown) -> int` _(builtin)_\n\n" + object.BuiltinDocs["len"]},
+	}
+
+	for _, tt := range tests {
+		hover := state.Hover(context.Background(), 1, uri, tt.position)
+		if hover.Result == nil {
+			t.Fatalf("Missing hover at %v", tt.position)
+		}
+
+		if hover.Result.Contents.Kind != markup_kind.Markdown {
+			t.Fatalf("Wrong markup kind, want=%s; got=%s", markup_kind.Markdown, hover.Result.Contents.Kind)
+		}
+
+		if hover.Result.Contents.Value != tt.expected {
+			t.Fatalf("Wrong hover at %v, want=%q; got=%q", tt.position, tt.expected, hover.Result.Contents.Value)
+		}
+	}
+
+	if hover := state.Hover(context.Background(), 1, uri, lsp.Position{Line: 0, Character: 8}); hover.Result != nil {
+		t.Fatalf("Hover outside of an identifier should be empty, got=%v", hover.Result)
+	}
+}
+
+func TestHoverDocComment(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "// not a doc\n\n// Answer to\n/* everything */\nlet a = 42;\na", 1)
+
+	hover := state.Hover(context.Background(), 1, uri, lsp.Position{Line: 5, Character: 0})
+	if hover.Result == nil {
+		t.Fatalf("Missing hover")
+	}
+
+	expected := "**a**: `int` _(global)_\n\n```monkey\nlet a = 42;\n```\n\nAnswer to\neverything"
+	if hover.Result.Contents.Value != expected {
+		t.Fatalf("Wrong hover, want=%q; got=%q", expected, hover.Result.Contents.Value)
+	}
+}
+
+func TestTypeDiagnosticsAndCompletionDetail(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+
+	diagnostics := state.OpenDocument(uri, "let a = \"a\";\nlet b = a - 1;\n", 1)
+	if len(diagnostics) != 1 || diagnostics[0].Code != "invalid-operation" {
+		t.Fatalf("Wrong diagnostics, want=[invalid-operation]; got=%v", diagnostics)
+	}
+
+	completion := state.TextDocumentCompletion(context.Background(), 1, lsp.Position{Line: 2, Character: 0}, uri)
+
+	details := map[string]string{}
+	for _, item := range completion.Result {
+		details[item.Label] = item.Detail
+	}
+
+	expected := map[string]string{"a": "string", "b": "int", "len": "fn(unknown) -> int"}
+	for label, detail := range expected {
+		if details[label] != detail {
+			t.Fatalf("Wrong detail of %s, want=%s; got=%s", label, detail, details[label])
+		}
+	}
+}
+
+func TestSignatureHelp(t *testing.T) {
+	tests := []struct {
+		input           string
+		position        lsp.Position
+		label           string
+		activeParameter int
+	}{
+		{"let add = fn(a, b) { a + b };\nadd(1, ", lsp.Position{Line: 1, Character: 7}, "add(a, b)", 1},
+		{"let add = fn(a, b) { a + b };\nadd(", lsp.Position{Line: 1, Character: 4}, "add(a, b)", 0},
+		{"let add = fn(a, b) { a + b };\nadd([1, 2], ", lsp.Position{Line: 1, Character: 12}, "add(a, b)", 1},
+		{"let add = fn(a, b) { a + b };\nadd((1 + 2", lsp.Position{Line: 1, Character: 10}, "add(a, b)", 0},
+		{"push([1], len(\"a\"))", lsp.Position{Line: 0, Character: 14}, "len(value)", 0},
+		{"push([1], len(\"a\"))", lsp.Position{Line: 0, Character: 18}, "push(array, value)", 1},
+		{"puts(1, 2, 3", lsp.Position{Line: 0, Character: 12}, "puts(values...)", 0},
+		{"let f = fn(x) { x };\nlet g = fn() { f(1 }", lsp.Position{Line: 1, Character: 18}, "f(x)", 0},
+		{"let add = fn(a, b) { a + b };\nadd(1, 2)", lsp.Position{Line: 1, Character: 9}, "", 0},
+		{"let add = fn(a, b) { add(fn(x", lsp.Position{Line: 0, Character: 29}, "", 0},
+		{"let add = fn(a, b) { a + b };\nadd(1, 2);\nlet x = 1", lsp.Position{Line: 2, Character: 9}, "", 0},
+	}
+
+	for _, tt := range tests {
+		state := NewState(MockLogger)
+		uri := "file:///a.monkey"
+		state.OpenDocument(uri, tt.input, 1)
+
+		help := state.SignatureHelp(context.Background(), 1, uri, tt.position)
+		if tt.label == "" {
+			if help.Result != nil {
+				t.Fatalf("Unexpected signature help in %q, got=%v", tt.input, help.Result)
+			}
+			continue
+		}
+
+		if help.Result == nil || len(help.Result.Signatures) != 1 {
+			t.Fatalf("Missing signature help in %q", tt.input)
+		}
+
+		if label := help.Result.Signatures[0].Label; label != tt.label {
+			t.Fatalf("Wrong signature in %q, want=%s; got=%s", tt.input, tt.label, label)
+		}
+
+		if help.Result.ActiveParameter != tt.activeParameter {
+			t.Fatalf("Wrong active parameter in %q, want=%d; got=%d",
+				tt.input, tt.activeParameter, help.Result.ActiveParameter)
+		}
+	}
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, `let a = 1;
+let f = fn(x, y) {
+  let z = x + y;
+  if (z > 1) { let w = z; }
+  map(fn(v) { let inner = v; });
+};
+f(1, 2);`, 1)
+
+	symbols := state.DocumentSymbol(context.Background(), 1, uri).Result
+
+	type expectedSymbol struct {
+		name     string
+		kind     int
+		children []string
+	}
+
+	expected := []expectedSymbol{
+		{"a", symbol_kind.Variable, nil},
+		{"f", symbol_kind.Function, []string{"x", "y", "z", "w", "inner"}},
+	}
+
+	if len(symbols) != len(expected) {
+		t.Fatalf("Wrong number of symbols, want=%d; got=%d", len(expected), len(symbols))
+	}
+
+	for i, e := range expected {
+		symbol := symbols[i]
+		if symbol.Name != e.name || symbol.Kind != e.kind {
+			t.Fatalf("Wrong symbol, want=%s (%d); got=%s (%d)", e.name, e.kind, symbol.Name, symbol.Kind)
+		}
+
+		if len(symbol.Children) != len(e.children) {
+			t.Fatalf("Wrong number of children of %s, want=%d; got=%d",
+				e.name, len(e.children), len(symbol.Children))
+		}
+
+		for j, child := range e.children {
+			if symbol.Children[j].Name != child {
+				t.Fatalf("Wrong child of %s, want=%s; got=%s", e.name, child, symbol.Children[j].Name)
+			}
+		}
+	}
+
+	f := symbols[1]
+	expectedRange := lsp.Range{Start: lsp.Position{Line: 1, Character: 0}, End: lsp.Position{Line: 5, Character: 2}}
+	if f.Range != expectedRange {
+		t.Fatalf("Wrong range of f, want=%v; got=%v", expectedRange, f.Range)
+	}
+
+	expectedSelection := lsp.Range{Start: lsp.Position{Line: 1, Character: 4}, End: lsp.Position{Line: 1, Character: 5}}
+	if f.SelectionRange != expectedSelection {
+		t.Fatalf("Wrong selection range of f, want=%v; got=%v", expectedSelection, f.SelectionRange)
+	}
+
+	if f.Detail != "fn(int, int) -> unknown" {
+		t.Fatalf("Wrong detail of f, want=fn(int, int) -> unknown; got=%s", f.Detail)
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "let a = 1; // one\nlet f = fn(x) { len(\"s\") + a + x };", 1)
+
+	full := state.SemanticTokensFull(context.Background(), 1, uri).Result
+	if full == nil {
+		t.Fatalf("Missing semantic tokens")
+	}
+
+	type decoded struct {
+		line, character, length int
+		tokenType               string
+		modifiers               []string
+	}
+
+	expected := []decoded{
+		{0, 0, 3, "keyword", nil},
+		{0, 4, 1, "variable", []string{"declaration", "readonly", "global"}},
+		{0, 6, 1, "operator", nil},
+		{0, 8, 1, "number", nil},
+		{0, 11, 6, "comment", nil},
+		{1, 0, 3, "keyword", nil},
+		{1, 4, 1, "function", []string{"declaration", "readonly", "global"}},
+		{1, 6, 1, "operator", nil},
+		{1, 8, 2, "keyword", nil},
+		{1, 11, 1, "parameter", []string{"declaration", "readonly", "local"}},
+		{1, 16, 3, "function", []string{"defaultLibrary"}},
+		{1, 20, 3, "string", nil},
+		{1, 25, 1, "operator", nil},
+		{1, 27, 1, "variable", []string{"readonly", "global"}},
+		{1, 29, 1, "operator", nil},
+		{1, 31, 1, "parameter", []string{"readonly", "local"}},
+	}
+
+	if len(full.Data) != len(expected)*5 {
+		t.Fatalf("Wrong number of tokens, want=%d; got=%d", len(expected), len(full.Data)/5)
+	}
+
+	line, character := 0, 0
+	for i, e := range expected {
+		data := full.Data[i*5 : i*5+5]
+		if data[0] != 0 {
+			character = 0
+		}
+		line += int(data[0])
+		character += int(data[1])
+
+		modifiers := []string{}
+		for j, modifier := range lsp.SemanticTokensLegend.TokenModifiers {
+			if data[4]&(1<<j) != 0 {
+				modifiers = append(modifiers, modifier)
+			}
+		}
+
+		got := decoded{line, character, int(data[2]), lsp.SemanticTokensLegend.TokenTypes[data[3]], modifiers}
+		if got.line != e.line || got.character != e.character || got.length != e.length ||
+			got.tokenType != e.tokenType || strings.Join(got.modifiers, ",") != strings.Join(e.modifiers, ",") {
+			t.Fatalf("Wrong token %d, want=%v; got=%v", i, e, got)
+		}
+	}
+
+	state.UpdateDocument(uri, 2, []lsp.TextDocumentContentChangeEvent{
+		createChange(0, 8, 0, 9, "12"),
+	})
+
+	delta := state.SemanticTokensDelta(context.Background(), 2, uri, full.ResultID).Result
+	edits, ok := delta.(lsp.SemanticTokensDelta)
+	if !ok {
+		t.Fatalf("Expected a delta, got=%T", delta)
+	}
+
+	current := state.SemanticTokensFull(context.Background(), 3, uri).Result.Data
+	applied := append([]uint32{}, full.Data...)
+	for _, edit := range edits.Edits {
+		applied = append(applied[:edit.Start], append(edit.Data, applied[edit.Start+edit.DeleteCount:]...)...)
+	}
+
+	if fmt.Sprint(applied) != fmt.Sprint(current) {
+		t.Fatalf("Wrong delta, want=%v; got=%v", current, applied)
+	}
+
+	if _, ok := state.SemanticTokensDelta(context.Background(), 4, uri, "unknown").Result.(lsp.SemanticTokens); !ok {
+		t.Fatalf("Unknown previous result should return full tokens")
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	options := lsp.FormattingOptions{TabSize: 2, InsertSpaces: true}
+	state.OpenDocument(uri, "let a=1\nlet b = fn(x){x}\nlet c=[1,2]", 1)
+
+	edits := state.Formatting(context.Background(), 1, uri, options).Result
+	if len(edits) != 1 {
+		t.Fatalf("Wrong number of edits, want=1; got=%d", len(edits))
+	}
+
+	expected := "let a = 1;\nlet b = fn(x) { x };\nlet c = [1, 2];\n"
+	if edits[0].NewText != expected {
+		t.Fatalf("Wrong formatting, want=%q; got=%q", expected, edits[0].NewText)
+	}
+
+	if end := (lsp.Position{Line: 2, Character: 11}); edits[0].Range.End != end {
+		t.Fatalf("Wrong end of the edit, want=%v; got=%v", end, edits[0].Range.End)
+	}
+
+	rangeEdits := state.RangeFormatting(context.Background(), 2, uri, lsp.Range{
+		Start: lsp.Position{Line: 1, Character: 2},
+		End:   lsp.Position{Line: 1, Character: 3},
+	}, options).Result
+	if len(rangeEdits) != 1 || rangeEdits[0].NewText != "let b = fn(x) { x };" {
+		t.Fatalf("Wrong range formatting, got=%v", rangeEdits)
+	}
+
+	expectedRange := lsp.Range{Start: lsp.Position{Line: 1, Character: 0}, End: lsp.Position{Line: 1, Character: 16}}
+	if rangeEdits[0].Range != expectedRange {
+		t.Fatalf("Wrong range of the edit, want=%v; got=%v", expectedRange, rangeEdits[0].Range)
+	}
+
+	// Columns after a non-ASCII character differ between bytes and UTF-16
+	state.OpenDocument(uri, `let s="é";let t = 1;`, 2)
+	rangeEdits = state.RangeFormatting(context.Background(), 3, uri, lsp.Range{
+		Start: lsp.Position{Line: 0, Character: 0},
+		End:   lsp.Position{Line: 0, Character: 5},
+	}, options).Result
+
+	expectedRange = lsp.Range{Start: lsp.Position{Line: 0, Character: 0}, End: lsp.Position{Line: 0, Character: 10}}
+	if len(rangeEdits) != 1 || rangeEdits[0].Range != expectedRange {
+		t.Fatalf("Wrong range formatting of non-ASCII text, want=%v; got=%v", expectedRange, rangeEdits)
+	}
+
+	document, _ := state.getDocument(context.Background(), uri)
+	result, err := applyContentChange(document.Text, document.lines, lsp.TextDocumentContentChangeEvent{
+		Range: &rangeEdits[0].Range,
+		Text:  rangeEdits[0].NewText,
+	})
+	if err != nil || result != "let s = \"é\";let t = 1;" {
+		t.Fatalf("Wrong text after the edit, got=%q", result)
+	}
+
+	state.OpenDocument(uri, "let a = ;", 3)
+	if edits := state.Formatting(context.Background(), 3, uri, options).Result; edits != nil {
+		t.Fatalf("Document with syntax errors shouldn't be formatted, got=%v", edits)
+	}
+}
+
+func TestFoldingRange(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, `// first
+// second
+let f = fn(x) {
+  if (x) {
+    1
+  } else {
+    [
+      2
+    ]
+  }
+};
+let a = [1]; // not a group
+// alone`, 1)
+
+	expected := []lsp.FoldingRange{
+		{StartLine: 0, EndLine: 1, Kind: "comment"},
+		{StartLine: 2, EndLine: 9},
+		{StartLine: 3, EndLine: 4},
+		{StartLine: 5, EndLine: 8},
+		{StartLine: 6, EndLine: 7},
+	}
+
+	got := state.FoldingRange(context.Background(), 1, uri).Result
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("Wrong folding ranges, want=%v; got=%v", expected, got)
+	}
+}
+
+func TestSelectionRange(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "let f = fn(x) {\n  len(x) + 1\n};\n", 1)
+
+	result := state.SelectionRange(context.Background(), 1, uri, []lsp.Position{{Line: 1, Character: 7}}).Result
+	if len(result) != 1 {
+		t.Fatalf("Wrong number of selection ranges, want=1; got=%d", len(result))
+	}
+
+	expected := []string{
+		"(1, 6) - (1, 7)",  // x
+		"(1, 2) - (1, 8)",  // len(x)
+		"(1, 2) - (1, 12)", // len(x) + 1
+		"(0, 14) - (2, 1)", // block
+		"(0, 8) - (2, 1)",  // fn
+		"(0, 0) - (2, 2)",  // let
+		"(0, 0) - (3, 0)",  // program
+	}
+
+	got := []string{}
+	for selection := &result[0]; selection != nil; selection = selection.Parent {
+		r := selection.Range
+		got = append(got, fmt.Sprintf("(%d, %d) - (%d, %d)", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character))
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("Wrong selection ranges, want=%v; got=%v", expected, got)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	input := "let a = b;\nlet s = \"a\" + 1;\nlet = 5;"
+
+	state := NewState(MockLogger)
+	expected := state.OpenDocument("file:///analyze.monkey", input, 1)
+
+	diagnostics := Analyze(input, MockLogger).Diagnostics
+
+	if len(expected) != 3 {
+		t.Fatalf("Wrong number of diagnostics, want=3; got=%d", len(expected))
+	}
+
+	if fmt.Sprint(diagnostics) != fmt.Sprint(expected) {
+		t.Fatalf("Wrong diagnostics, want=%v; got=%v", expected, diagnostics)
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	state := NewState(MockLogger)
+	state.OpenDocument("file:///run.monkey", "let a = 1;\nlet b = a + 2; b * 2", 1)
+	state.OpenDocument("file:///loop.monkey", "let f = fn() { f() };\nf()", 1)
+	state.OpenDocument("file:///wide.monkey", "let s = \"é\"; 1 / 0", 1)
+	state.OpenDocument("file:///grow.monkey",
+		"let f = fn(s, n) { if (n == 0) { len(s) } else { f(s + s, n - 1) } };\nf(\"a\", 40)", 1)
+
+	tests := []struct {
+		command        string
+		arguments      string
+		expectedResult any
+		expectedError  string
+		expectedRange  string
+	}{
+		{"monkey.runFile", `["file:///run.monkey"]`, "6", "", ""},
+		{
+			"monkey.runSelection",
+			`["file:///run.monkey", {"start":{"line":1,"character":15},"end":{"line":1,"character":20}}]`,
+			nil,
+			"identifier not found: b",
+			"1:15-1:16",
+		},
+		{"monkey.runFile", `["file:///loop.monkey"]`, nil, "stack overflow", "0:15-0:18"},
+		{
+			"monkey.runSelection",
+			`["file:///wide.monkey", {"start":{"line":0,"character":13},"end":{"line":0,"character":18}}]`,
+			nil,
+			"division by zero",
+			"0:13-0:18",
+		},
+		{"monkey.runFile", `["file:///grow.monkey"]`, nil, "allocation limit of 67108864 bytes exceeded", "0:51-0:56"},
+	}
+
+	for _, tt := range tests {
+		var arguments []json.RawMessage
+		if err := json.Unmarshal([]byte(tt.arguments), &arguments); err != nil {
+			t.Fatalf("Invalid arguments %s: %s", tt.arguments, err)
+		}
+
+		result, err := state.ExecuteCommand(context.Background(), 1, tt.command, arguments, io.Discard)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", tt.arguments, err)
+		}
+
+		if result.Response.Result != tt.expectedResult {
+			t.Fatalf("Wrong result for %s, want=%v; got=%v", tt.arguments, tt.expectedResult, result.Response.Result)
+		}
+
+		runtimeErrors := []lsp.Diagnostic{}
+		for _, d := range result.Diagnostics {
+			if d.Code == runtimeErrorCode {
+				runtimeErrors = append(runtimeErrors, d)
+			}
+		}
+
+		if tt.expectedError == "" {
+			if len(runtimeErrors) != 0 {
+				t.Fatalf("Unexpected runtime error for %s: %s", tt.arguments, runtimeErrors[0].Message)
+			}
+			continue
+		}
+
+		if len(runtimeErrors) != 1 || runtimeErrors[0].Message != tt.expectedError {
+			t.Fatalf("Wrong runtime errors for %s, want=%q; got=%v", tt.arguments, tt.expectedError, runtimeErrors)
+		}
+
+		r := runtimeErrors[0].Range
+		got := fmt.Sprintf("%d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
+		if got != tt.expectedRange {
+			t.Fatalf("Wrong range for %s, want=%s; got=%s", tt.arguments, tt.expectedRange, got)
+		}
+	}
+}
+
+func TestWhileCurrent(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+	state.OpenDocument(uri, "1", 1)
+
+	called := false
+	if !state.WhileCurrent(uri, 1, func() { called = true }) || !called {
+		t.Fatalf("Function should be called for the current version")
+	}
+
+	if _, err := state.UpdateDocument(uri, 2, []lsp.TextDocumentContentChangeEvent{{Text: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	called = false
+	if state.WhileCurrent(uri, 1, func() { called = true }) || called {
+		t.Fatalf("Function shouldn't be called for an old version")
+	}
+
+	state.CloseDocument(uri)
+	if state.WhileCurrent(uri, 2, func() { called = true }) || called {
+		t.Fatalf("Function shouldn't be called for a closed document")
+	}
+}
@@ -0,0 +1,84 @@
+package analysis
+
+import (
+	"context"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/SymbolKind"
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/types"
+)
+
+func (s *State) DocumentSymbol(
+	ctx context.Context,
+	id int,
+	uri string,
+) lsp.DocumentSymbolResponse {
+	response := lsp.DocumentSymbolResponse{
+		Response: lsp.Response{RPC: "2.0", ID: &id},
+		Result:   []lsp.DocumentSymbol{},
+	}
+
+	document, ok := s.getDocument(ctx, uri)
+	if !ok || ctx.Err() != nil {
+		return response
+	}
+
+	response.Result = document.documentSymbols(document.Program)
+	return response
+}
+
+// documentSymbols returns symbols of let statements under the node. Lets
+// nested in other expressions, like anonymous functions, belong to the closest
+// enclosing let.
+func (d *Document) documentSymbols(node ast.Node) []lsp.DocumentSymbol {
+	symbols := []lsp.DocumentSymbol{}
+
+	for _, child := range ast.Children(node) {
+		let, ok := child.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			symbols = append(symbols, d.documentSymbols(child)...)
+			continue
+		}
+
+		symbol := lsp.DocumentSymbol{
+			Name:           let.Name.Value,
+			Detail:         d.typeDetail(let.Name),
+			Kind:           symbol_kind.Variable,
+			Range:          d.toLspRange(let.Range()),
+			SelectionRange: d.toLspRange(let.Name.Range()),
+		}
+
+		if literal, ok := let.Value.(*ast.FunctionLiteral); ok {
+			symbol.Kind = symbol_kind.Function
+			if literal.Name != "" {
+				symbol.Name = literal.Name
+			}
+
+			for _, p := range literal.Parameters {
+				symbol.Children = append(symbol.Children, lsp.DocumentSymbol{
+					Name:           p.Value,
+					Detail:         d.typeDetail(p),
+					Kind:           symbol_kind.Variable,
+					Range:          d.toLspRange(p.Range()),
+					SelectionRange: d.toLspRange(p.Range()),
+				})
+			}
+		}
+
+		if let.Value != nil {
+			symbol.Children = append(symbol.Children, d.documentSymbols(let.Value)...)
+		}
+
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
+
+func (d *Document) typeDetail(ident *ast.Identifier) string {
+	if t := d.Types.TypeOf(ident); t != types.Unknown {
+		return t.String()
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// lineIndex holds byte offsets of the start of every line in a text.
+type lineIndex []int
+
+func newLineIndex(text string) lineIndex {
+	lines := lineIndex{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+// offset converts an LSP position into a byte offset. Characters are counted
+// in UTF-16 code units as the protocol requires, positions past the end of a
+// line or of the text are clamped.
+func (li lineIndex) offset(text string, position lsp.Position) int {
+	if position.Line < 0 {
+		return 0
+	}
+	if position.Line >= len(li) {
+		return len(text)
+	}
+
+	lineStart := li[position.Line]
+	line := strings.TrimSuffix(li.line(text, position.Line), "\r")
+
+	units := 0
+	for i, r := range line {
+		if units >= position.Character {
+			return lineStart + i
+		}
+		units += utf16Length(r)
+	}
+
+	return lineStart + len(line)
+}
+
+// line returns the text of an existing line without the newline.
+func (li lineIndex) line(text string, line int) string {
+	end := len(text)
+	if line+1 < len(li) {
+		end = li[line+1] - 1
+	}
+	return text[li[line]:end]
+}
+
+// lspPosition converts a position of the lexer, whose characters are bytes,
+// into an LSP one counted in UTF-16 code units. Characters past the end of the
+// line are kept as they are.
+func (li lineIndex) lspPosition(text string, position token.Position) lsp.Position {
+	if position.Line < 0 || position.Line >= len(li) {
+		return lsp.Position(position)
+	}
+
+	line := li.line(text, position.Line)
+	prefix := line
+	if position.Character < len(line) {
+		prefix = line[:position.Character]
+	}
+
+	units := max(position.Character-len(line), 0)
+	for _, r := range prefix {
+		units += utf16Length(r)
+	}
+
+	return lsp.Position{Line: position.Line, Character: units}
+}
+
+func (li lineIndex) lspRange(text string, r token.Range) lsp.Range {
+	return lsp.Range{
+		Start: li.lspPosition(text, r.Start),
+		End:   li.lspPosition(text, r.End),
+	}
+}
+
+// tokenPosition converts an LSP position into a position of the lexer. Like
+// offset, it clamps positions past the end of a line or of the text.
+func (li lineIndex) tokenPosition(text string, position lsp.Position) token.Position {
+	line := min(max(position.Line, 0), len(li)-1)
+	return token.Position{Line: line, Character: li.offset(text, position) - li[line]}
+}
+
+func utf16Length(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+func applyContentChange(
+	text string,
+	lines lineIndex,
+	change lsp.TextDocumentContentChangeEvent,
+) (string, error) {
+	if change.Range == nil {
+		return change.Text, nil
+	}
+
+	start := lines.offset(text, change.Range.Start)
+	end := lines.offset(text, change.Range.End)
+	if start > end {
+		return "", fmt.Errorf(
+			"invalid change range (%d, %d) - (%d, %d)",
+			change.Range.Start.Line,
+			change.Range.Start.Character,
+			change.Range.End.Line,
+			change.Range.End.Character,
+		)
+	}
+
+	return text[:start] + change.Text + text[end:], nil
+}
+
+// end returns the position right after the last character of the text.
+func (li lineIndex) end(text string) lsp.Position {
+	last := len(li) - 1
+
+	units := 0
+	for _, r := range text[li[last]:] {
+		units += utf16Length(r)
+	}
+
+	return lsp.Position{Line: last, Character: units}
+}
@@ -0,0 +1,139 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+func TestApplyContentChange(t *testing.T) {
+	text := "let a = 1;\nlet b = 2;\nlet ü = \"😀\";"
+
+	tests := []struct {
+		change   lsp.TextDocumentContentChangeEvent
+		expected string
+	}{
+		{
+			createChange(0, 4, 0, 5, "aa"),
+			"let aa = 1;\nlet b = 2;\nlet ü = \"😀\";",
+		},
+		{
+			createChange(0, 10, 1, 10, ""),
+			"let a = 1;\nlet ü = \"😀\";",
+		},
+		{
+			createChange(2, 9, 2, 11, "x"),
+			"let a = 1;\nlet b = 2;\nlet ü = \"x\";",
+		},
+		{
+			createChange(1, 100, 1, 100, " b;"),
+			"let a = 1;\nlet b = 2; b;\nlet ü = \"😀\";",
+		},
+		{
+			createChange(5, 0, 5, 0, "\nend"),
+			"let a = 1;\nlet b = 2;\nlet ü = \"😀\";\nend",
+		},
+		{
+			lsp.TextDocumentContentChangeEvent{Text: "full"},
+			"full",
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := applyContentChange(text, newLineIndex(text), tt.change)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result != tt.expected {
+			t.Fatalf("Wrong text after change, want=%q; got=%q", tt.expected, result)
+		}
+	}
+}
+
+func TestLspPosition(t *testing.T) {
+	text := "let ü = \"😀\"; x\r\nlet b = 1;"
+	lines := newLineIndex(text)
+
+	tests := []struct {
+		position token.Position
+		expected lsp.Position
+	}{
+		{token.Position{Line: 0, Character: 4}, lsp.Position{Line: 0, Character: 4}},
+		{token.Position{Line: 0, Character: 6}, lsp.Position{Line: 0, Character: 5}},
+		{token.Position{Line: 0, Character: 15}, lsp.Position{Line: 0, Character: 12}},
+		{token.Position{Line: 0, Character: 20}, lsp.Position{Line: 0, Character: 17}},
+		{token.Position{Line: 1, Character: 10}, lsp.Position{Line: 1, Character: 10}},
+		{token.Position{Line: 2, Character: 0}, lsp.Position{Line: 2, Character: 0}},
+	}
+
+	for _, tt := range tests {
+		if got := lines.lspPosition(text, tt.position); got != tt.expected {
+			t.Fatalf("Wrong position for %v, want=%v; got=%v", tt.position, tt.expected, got)
+		}
+	}
+}
+
+func TestDiagnosticsAreUTF16(t *testing.T) {
+	diagnostics := Analyze("let s = \"é\"; zz", MockLogger).Diagnostics
+	if len(diagnostics) != 1 {
+		t.Fatalf("Wrong number of diagnostics, want=1; got=%d", len(diagnostics))
+	}
+
+	expected := lsp.Range{
+		Start: lsp.Position{Line: 0, Character: 13},
+		End:   lsp.Position{Line: 0, Character: 15},
+	}
+	if diagnostics[0].Range != expected {
+		t.Fatalf("Wrong range, want=%v; got=%v", expected, diagnostics[0].Range)
+	}
+}
+
+func TestUpdateDocumentVersions(t *testing.T) {
+	state := NewState(MockLogger)
+	uri := "file:///a.monkey"
+
+	state.OpenDocument(uri, "let a = 1;", 1)
+
+	_, err := state.UpdateDocument(uri, 2, []lsp.TextDocumentContentChangeEvent{
+		createChange(0, 9, 0, 9, " + b"),
+		createChange(0, 13, 0, 13, " + c"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := state.Documents[uri]
+	if document.Text != "let a = 1 + b + c;" {
+		t.Fatalf("Wrong text after update, got=%q", document.Text)
+	}
+
+	if len(document.Diagnostics) != 2 {
+		t.Fatalf("Wrong number of diagnostics, want=2; got=%d", len(document.Diagnostics))
+	}
+
+	_, err = state.UpdateDocument(uri, 2, []lsp.TextDocumentContentChangeEvent{
+		{Text: "stale"},
+	})
+	if err == nil {
+		t.Fatalf("Expected stale change to be rejected")
+	}
+
+	if state.Documents[uri].Text != "let a = 1 + b + c;" {
+		t.Fatalf("Stale change modified the document, got=%q", state.Documents[uri].Text)
+	}
+}
+
+func createChange(
+	startLine, startCharacter, endLine, endCharacter int,
+	text string,
+) lsp.TextDocumentContentChangeEvent {
+	return lsp.TextDocumentContentChangeEvent{
+		Range: &lsp.Range{
+			Start: lsp.Position{Line: startLine, Character: startCharacter},
+			End:   lsp.Position{Line: endLine, Character: endCharacter},
+		},
+		Text: text,
+	}
+}
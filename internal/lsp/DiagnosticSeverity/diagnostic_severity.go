@@ -0,0 +1,8 @@
+package diagnostic_severity
+
+const (
+	Error       = 1
+	Warning     = 2
+	Information = 3
+	Hint        = 4
+)
@@ -0,0 +1,7 @@
+package document_highlight_kind
+
+const (
+	Text  = 1
+	Read  = 2
+	Write = 3
+)
@@ -0,0 +1,18 @@
+package error_codes
+
+const (
+	// JSON-RPC
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+
+	// LSP
+	ServerNotInitialized = -32002
+	UnknownErrorCode     = -32001
+	RequestFailed        = -32803
+	ServerCancelled      = -32802
+	ContentModified      = -32801
+	RequestCancelled     = -32800
+)
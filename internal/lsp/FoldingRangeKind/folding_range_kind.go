@@ -0,0 +1,7 @@
+package folding_range_kind
+
+const (
+	Comment = "comment"
+	Imports = "imports"
+	Region  = "region"
+)
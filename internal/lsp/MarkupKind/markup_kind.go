@@ -0,0 +1,6 @@
+package markup_kind
+
+const (
+	PlainText = "plaintext"
+	Markdown  = "markdown"
+)
@@ -0,0 +1,8 @@
+package message_type
+
+const (
+	Error   = 1
+	Warning = 2
+	Info    = 3
+	Log     = 4
+)
@@ -0,0 +1,12 @@
+package semantic_token_modifiers
+
+const (
+	Declaration    = "declaration"
+	Readonly       = "readonly"
+	DefaultLibrary = "defaultLibrary"
+
+	// Not part of the specification, they tell where a variable lives
+	Global   = "global"
+	Local    = "local"
+	Captured = "captured"
+)
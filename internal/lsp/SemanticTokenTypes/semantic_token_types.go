@@ -0,0 +1,12 @@
+package semantic_token_types
+
+const (
+	Function  = "function"
+	Parameter = "parameter"
+	Variable  = "variable"
+	Keyword   = "keyword"
+	String    = "string"
+	Number    = "number"
+	Operator  = "operator"
+	Comment   = "comment"
+)
@@ -0,0 +1,7 @@
+package text_document_sync_kind
+
+const (
+	None        = 0
+	Full        = 1
+	Incremental = 2
+)
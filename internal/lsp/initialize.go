@@ -1,5 +1,7 @@
 package lsp
 
+import "github.com/marcsek/monkey-language-server/internal/lsp/TextDocumentSyncKind"
+
 type InitializeRequest struct {
 	Request
 	Params InitializeRequestParams `json:"params"`
@@ -25,11 +27,23 @@ type InitializeResult struct {
 }
 
 type ServerCapabilities struct {
-	TextDocumentSync   int            `json:"textDocumentSync"`
-	HoverProvider      bool           `json:"hoverProvider"`
-	DefinitionProvider bool           `json:"definitionProvider"`
-	CodeActionProvider bool           `json:"codeActionProvider"`
-	CompletionProvider map[string]any `json:"completionProvider"`
+	TextDocumentSync                int            `json:"textDocumentSync"`
+	HoverProvider                   bool           `json:"hoverProvider"`
+	DefinitionProvider              bool           `json:"definitionProvider"`
+	ReferencesProvider              bool           `json:"referencesProvider"`
+	DocumentHighlightProvider       bool           `json:"documentHighlightProvider"`
+	DocumentSymbolProvider          bool           `json:"documentSymbolProvider"`
+	DocumentFormattingProvider      bool           `json:"documentFormattingProvider"`
+	DocumentRangeFormattingProvider bool           `json:"documentRangeFormattingProvider"`
+	FoldingRangeProvider            bool           `json:"foldingRangeProvider"`
+	SelectionRangeProvider          bool           `json:"selectionRangeProvider"`
+	RenameProvider                  map[string]any `json:"renameProvider"`
+	CodeActionProvider              bool           `json:"codeActionProvider"`
+	CompletionProvider              map[string]any `json:"completionProvider"`
+	SignatureHelpProvider           map[string]any `json:"signatureHelpProvider"`
+
+	SemanticTokensProvider *SemanticTokensOptions `json:"semanticTokensProvider"`
+	ExecuteCommandProvider *ExecuteCommandOptions `json:"executeCommandProvider"`
 }
 
 type ServerInfo struct {
@@ -45,11 +59,29 @@ func NewInitializeResponse(id int) InitializeResponse {
 		},
 		Result: InitializeResult{
 			Capabilities: ServerCapabilities{
-				TextDocumentSync:   1,
-				HoverProvider:      true,
-				DefinitionProvider: true,
-				CodeActionProvider: true,
-				CompletionProvider: map[string]any{},
+				TextDocumentSync:                text_document_sync_kind.Incremental,
+				HoverProvider:                   true,
+				DefinitionProvider:              true,
+				ReferencesProvider:              true,
+				DocumentHighlightProvider:       true,
+				DocumentSymbolProvider:          true,
+				DocumentFormattingProvider:      true,
+				DocumentRangeFormattingProvider: true,
+				FoldingRangeProvider:            true,
+				SelectionRangeProvider:          true,
+				RenameProvider:                  map[string]any{"prepareProvider": true},
+				CodeActionProvider:              true,
+				CompletionProvider:              map[string]any{},
+				SignatureHelpProvider: map[string]any{
+					"triggerCharacters": []string{"(", ","},
+				},
+				SemanticTokensProvider: &SemanticTokensOptions{
+					Legend: SemanticTokensLegend,
+					Full:   map[string]any{"delta": true},
+				},
+				ExecuteCommandProvider: &ExecuteCommandOptions{
+					Commands: []string{RunFileCommand, RunSelectionCommand},
+				},
 			},
 			ServerInfo: &ServerInfo{
 				Name:    "monkey-lsp",
@@ -0,0 +1,20 @@
+package lsp
+
+type ShutdownRequest struct {
+	Request
+}
+
+type ShutdownResponse struct {
+	Response
+	Result *struct{} `json:"result"`
+}
+
+func NewShutdownResponse(id int) ShutdownResponse {
+	return ShutdownResponse{
+		Response: Response{
+			RPC: "2.0",
+			ID:  &id,
+		},
+		Result: nil,
+	}
+}
@@ -15,3 +15,28 @@ type Notification struct {
 	RPC    string `json:"jsonrpc"`
 	Method string `json:"method"`
 }
+
+// ErrorResponse doesn't embed Response, because its id has to be sent as null
+// when the id of the failed request couldn't be determined.
+type ErrorResponse struct {
+	RPC   string        `json:"jsonrpc"`
+	ID    *int          `json:"id"`
+	Error ResponseError `json:"error"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func NewErrorResponse(id *int, code int, message string) ErrorResponse {
+	return ErrorResponse{
+		RPC: "2.0",
+		ID:  id,
+		Error: ResponseError{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
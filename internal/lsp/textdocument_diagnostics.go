@@ -7,12 +7,14 @@ type PublishDiagnosticsNotification struct {
 
 type PublishDiagnosticsParams struct {
 	URI         string       `json:"uri"`
+	Version     int          `json:"version,omitempty"`
 	Diagnostics []Diagnostic `json:"diagnostics"`
 }
 
 type Diagnostic struct {
 	Range    Range  `json:"range"`
 	Severity int    `json:"severity"`
+	Code     string `json:"code,omitempty"`
 	Source   string `json:"source"`
 	Message  string `json:"message"`
 }
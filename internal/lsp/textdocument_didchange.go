@@ -10,6 +10,10 @@ type DidChangeNotificationParams struct {
 	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
 }
 
+// TextDocumentContentChangeEvent replaces the whole document when Range is
+// nil, otherwise only the text inside Range is replaced.
 type TextDocumentContentChangeEvent struct {
-	Text string `json:"text"`
+	Range       *Range `json:"range,omitempty"`
+	RangeLength *int   `json:"rangeLength,omitempty"`
+	Text        string `json:"text"`
 }
@@ -0,0 +1,20 @@
+package lsp
+
+type DocumentHighlightRequest struct {
+	Request
+	Params DocumentHighlightParams `json:"params"`
+}
+
+type DocumentHighlightParams struct {
+	TextDocumentPositionParams
+}
+
+type DocumentHighlightResponse struct {
+	Response
+	Result []DocumentHighlight `json:"result"`
+}
+
+type DocumentHighlight struct {
+	Range Range `json:"range"`
+	Kind  int   `json:"kind"`
+}
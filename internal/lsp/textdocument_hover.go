@@ -11,9 +11,15 @@ type HoverParams struct {
 
 type HoverResponse struct {
 	Response
-	Result HoverResult `json:"result"`
+	Result *HoverResult `json:"result"`
 }
 
 type HoverResult struct {
-	Contents string `json:"contents"`
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
 }
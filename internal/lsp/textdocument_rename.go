@@ -0,0 +1,31 @@
+package lsp
+
+type RenameRequest struct {
+	Request
+	Params RenameParams `json:"params"`
+}
+
+type RenameParams struct {
+	TextDocumentPositionParams
+	NewName string `json:"newName"`
+}
+
+type RenameResponse struct {
+	Response
+	Result *WorkspaceEdit `json:"result"`
+}
+
+type PrepareRenameRequest struct {
+	Request
+	Params TextDocumentPositionParams `json:"params"`
+}
+
+type PrepareRenameResponse struct {
+	Response
+	Result *PrepareRenameResult `json:"result"`
+}
+
+type PrepareRenameResult struct {
+	Range       Range  `json:"range"`
+	Placeholder string `json:"placeholder"`
+}
@@ -0,0 +1,23 @@
+package lsp
+
+type SelectionRangeRequest struct {
+	Request
+	Params SelectionRangeParams `json:"params"`
+}
+
+type SelectionRangeParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Positions    []Position             `json:"positions"`
+}
+
+type SelectionRangeResponse struct {
+	Response
+	Result []SelectionRange `json:"result"`
+}
+
+// SelectionRange is a range with the ranges that contain it, the parent is
+// the next step when the selection is expanded.
+type SelectionRange struct {
+	Range  Range           `json:"range"`
+	Parent *SelectionRange `json:"parent,omitempty"`
+}
@@ -0,0 +1,86 @@
+package lsp
+
+import (
+	"github.com/marcsek/monkey-language-server/internal/lsp/SemanticTokenModifiers"
+	"github.com/marcsek/monkey-language-server/internal/lsp/SemanticTokenTypes"
+)
+
+// SemanticTokensLegend is sent to the client during initialization. Token
+// types and modifiers in the encoded data are indexes into these lists.
+var SemanticTokensLegend = SemanticTokensLegendOptions{
+	TokenTypes: []string{
+		semantic_token_types.Function,
+		semantic_token_types.Parameter,
+		semantic_token_types.Variable,
+		semantic_token_types.Keyword,
+		semantic_token_types.String,
+		semantic_token_types.Number,
+		semantic_token_types.Operator,
+		semantic_token_types.Comment,
+	},
+	TokenModifiers: []string{
+		semantic_token_modifiers.Declaration,
+		semantic_token_modifiers.Readonly,
+		semantic_token_modifiers.DefaultLibrary,
+		semantic_token_modifiers.Global,
+		semantic_token_modifiers.Local,
+		semantic_token_modifiers.Captured,
+	},
+}
+
+type SemanticTokensLegendOptions struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+type SemanticTokensOptions struct {
+	Legend SemanticTokensLegendOptions `json:"legend"`
+	Full   map[string]any              `json:"full"`
+}
+
+type SemanticTokensRequest struct {
+	Request
+	Params SemanticTokensParams `json:"params"`
+}
+
+type SemanticTokensParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type SemanticTokensResponse struct {
+	Response
+	Result *SemanticTokens `json:"result"`
+}
+
+type SemanticTokens struct {
+	ResultID string   `json:"resultId,omitempty"`
+	Data     []uint32 `json:"data"`
+}
+
+type SemanticTokensDeltaRequest struct {
+	Request
+	Params SemanticTokensDeltaParams `json:"params"`
+}
+
+type SemanticTokensDeltaParams struct {
+	TextDocument     TextDocumentIdentifier `json:"textDocument"`
+	PreviousResultID string                 `json:"previousResultId"`
+}
+
+// SemanticTokensDeltaResponse holds either SemanticTokensDelta or, when the
+// previous result is unknown, full SemanticTokens.
+type SemanticTokensDeltaResponse struct {
+	Response
+	Result any `json:"result"`
+}
+
+type SemanticTokensDelta struct {
+	ResultID string               `json:"resultId,omitempty"`
+	Edits    []SemanticTokensEdit `json:"edits"`
+}
+
+type SemanticTokensEdit struct {
+	Start       int      `json:"start"`
+	DeleteCount int      `json:"deleteCount"`
+	Data        []uint32 `json:"data,omitempty"`
+}
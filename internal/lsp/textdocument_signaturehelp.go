@@ -0,0 +1,32 @@
+package lsp
+
+type SignatureHelpRequest struct {
+	Request
+	Params SignatureHelpParams `json:"params"`
+}
+
+type SignatureHelpParams struct {
+	TextDocumentPositionParams
+}
+
+type SignatureHelpResponse struct {
+	Response
+	Result *SignatureHelp `json:"result"`
+}
+
+type SignatureHelp struct {
+	Signatures      []SignatureInformation `json:"signatures"`
+	ActiveSignature int                    `json:"activeSignature"`
+	ActiveParameter int                    `json:"activeParameter"`
+}
+
+type SignatureInformation struct {
+	Label         string                 `json:"label"`
+	Documentation *MarkupContent         `json:"documentation,omitempty"`
+	Parameters    []ParameterInformation `json:"parameters"`
+}
+
+// ParameterInformation labels the parameter with its offsets in the signature label.
+type ParameterInformation struct {
+	Label [2]int `json:"label"`
+}
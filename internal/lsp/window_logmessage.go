@@ -0,0 +1,11 @@
+package lsp
+
+type LogMessageNotification struct {
+	Notification
+	Params LogMessageParams `json:"params"`
+}
+
+type LogMessageParams struct {
+	Type    int    `json:"type"`
+	Message string `json:"message"`
+}
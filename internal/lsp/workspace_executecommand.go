@@ -0,0 +1,31 @@
+package lsp
+
+import "encoding/json"
+
+// Commands the server executes. Both take the document URI as their first
+// argument, runSelection takes the selected Range as its second.
+const (
+	RunFileCommand      = "monkey.runFile"
+	RunSelectionCommand = "monkey.runSelection"
+)
+
+type ExecuteCommandOptions struct {
+	Commands []string `json:"commands"`
+}
+
+type ExecuteCommandRequest struct {
+	Request
+	Params ExecuteCommandParams `json:"params"`
+}
+
+// ExecuteCommandParams keeps the arguments raw, their types depend on the
+// command.
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+type ExecuteCommandResponse struct {
+	Response
+	Result any `json:"result"`
+}
@@ -1,12 +1,21 @@
 package messageHandler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
 
 	"github.com/marcsek/monkey-language-server/internal/analysis"
 	"github.com/marcsek/monkey-language-server/internal/lsp"
+	"github.com/marcsek/monkey-language-server/internal/lsp/ErrorCodes"
+	"github.com/marcsek/monkey-language-server/internal/lsp/MessageType"
 	"github.com/marcsek/monkey-language-server/internal/rpc"
 )
 
@@ -15,6 +24,21 @@ type MessageHandler struct {
 	writer io.Writer
 	state  *analysis.State
 	logger *log.Logger
+
+	isShutdown bool
+	exit       func(code int)
+
+	writeMu   sync.Mutex
+	pendingMu sync.Mutex
+	pending   map[int]*pendingRequest
+	workers   sync.WaitGroup
+}
+
+// pendingRequest is a running request that can be cancelled. Clients may reuse
+// the id of a finished request, so entries are compared by pointer to leave
+// the one of a newer request alone.
+type pendingRequest struct {
+	cancel context.CancelFunc
 }
 
 func New(
@@ -28,25 +52,136 @@ func New(
 		writer: writer,
 		state:  state,
 		logger: logger,
+		exit:   os.Exit,
+
+		pending: map[int]*pendingRequest{},
+	}
+}
+
+// Dispatch handles notifications and lifecycle requests in order on the calling
+// goroutine. Other requests are handled on their own goroutines and can be
+// cancelled, they get a snapshot of the documents taken when they arrived, so
+// they never see changes that came after them.
+func (mh *MessageHandler) Dispatch(method string, contents []byte) {
+	id, isRequest := requestID(contents)
+
+	switch {
+	case method == "$/cancelRequest":
+		mh.cancelRequest(contents)
+
+	case method == "shutdown":
+		mh.Wait()
+		mh.HandleMessage(context.Background(), method, contents)
+
+	case !isRequest || method == "initialize":
+		mh.HandleMessage(context.Background(), method, contents)
+
+	default:
+		ctx, cancel := context.WithCancel(mh.state.Snapshot(context.Background()))
+
+		request := &pendingRequest{cancel: cancel}
+
+		mh.pendingMu.Lock()
+		mh.pending[id] = request
+		mh.pendingMu.Unlock()
+
+		mh.workers.Add(1)
+		go func() {
+			defer mh.workers.Done()
+			defer func() {
+				mh.pendingMu.Lock()
+				if mh.pending[id] == request {
+					delete(mh.pending, id)
+				}
+				mh.pendingMu.Unlock()
+				cancel()
+			}()
+
+			mh.HandleMessage(ctx, method, contents)
+		}()
+	}
+}
+
+// Wait blocks until all requests started by Dispatch are finished.
+func (mh *MessageHandler) Wait() {
+	mh.workers.Wait()
+}
+
+func (mh *MessageHandler) cancelRequest(contents []byte) {
+	request, err := parseMessage[lsp.CancelRequestNotification](contents)
+	if err != nil {
+		mh.logger.Printf("Couldn't parse cancel request: %s", err)
+		return
+	}
+
+	mh.pendingMu.Lock()
+	defer mh.pendingMu.Unlock()
+
+	if pending, ok := mh.pending[request.Params.ID]; ok {
+		mh.logger.Printf("Cancelling request %d", request.Params.ID)
+		pending.cancel()
 	}
 }
 
-func (mh *MessageHandler) HandleMessage(method string, contents []byte) {
+func (mh *MessageHandler) HandleMessage(ctx context.Context, method string, contents []byte) {
 	mh.logger.Printf("Received %s", method)
 
+	defer func() {
+		if r := recover(); r != nil {
+			mh.logger.Printf("Panic while handling \"%s\": %v\n%s", method, r, debug.Stack())
+			mh.sendRequestError(contents, error_codes.InternalError, fmt.Sprintf("%v", r))
+		}
+	}()
+
+	if mh.isShutdown && method != "exit" {
+		// Notifications are dropped, requests have to be answered with an error
+		mh.sendRequestError(contents, error_codes.InvalidRequest, "Server is shutting down")
+		return
+	}
+
 	switch method {
 	case "initialize":
-		request := parseMessage[lsp.InitializeRequest](contents, mh.logger, method)
+		request, err := parseMessage[lsp.InitializeRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
 
 		msg := lsp.NewInitializeResponse(request.ID)
 		mh.sendMessage(msg)
 
+	case "initialized":
+		mh.logger.Println("Client initialized")
+
+	case "shutdown":
+		request, err := parseMessage[lsp.ShutdownRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		mh.isShutdown = true
+		mh.sendMessage(lsp.NewShutdownResponse(request.ID))
+
+	case "exit":
+		// The spec mandates exit code 1 when no shutdown request preceded exit
+		if mh.isShutdown {
+			mh.exit(0)
+		} else {
+			mh.exit(1)
+		}
+
 	case "textDocument/didOpen":
-		request := parseMessage[lsp.DidOpenTextDocumentNotification](contents, mh.logger, method)
+		request, err := parseMessage[lsp.DidOpenTextDocumentNotification](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
 
 		diagnostics := mh.state.OpenDocument(
 			request.Params.TextDocument.URI,
 			request.Params.TextDocument.Text,
+			request.Params.TextDocument.Version,
 		)
 		mh.sendMessage(lsp.PublishDiagnosticsNotification{
 			Notification: lsp.Notification{
@@ -55,75 +190,429 @@ func (mh *MessageHandler) HandleMessage(method string, contents []byte) {
 			},
 			Params: lsp.PublishDiagnosticsParams{
 				URI:         request.Params.TextDocument.URI,
+				Version:     request.Params.TextDocument.Version,
 				Diagnostics: diagnostics,
 			},
 		})
 
 	case "textDocument/didChange":
-		request := parseMessage[lsp.TextDocumentDidChangeNotification](contents, mh.logger, method)
+		request, err := parseMessage[lsp.TextDocumentDidChangeNotification](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
 
-		for _, change := range request.Params.ContentChanges {
-			diagnostics := mh.state.UpdateDocument(request.Params.TextDocument.URI, change.Text)
-			mh.sendMessage(lsp.PublishDiagnosticsNotification{
-				Notification: lsp.Notification{
-					RPC:    "2.0",
-					Method: "textDocument/publishDiagnostics",
-				},
-				Params: lsp.PublishDiagnosticsParams{
-					URI:         request.Params.TextDocument.URI,
-					Diagnostics: diagnostics,
-				},
-			})
+		diagnostics, err := mh.state.UpdateDocument(
+			request.Params.TextDocument.URI,
+			request.Params.TextDocument.Version,
+			request.Params.ContentChanges,
+		)
+		if err != nil {
+			mh.logger.Printf("Couldn't update document: %s", err)
+			return
+		}
+
+		mh.sendMessage(lsp.PublishDiagnosticsNotification{
+			Notification: lsp.Notification{
+				RPC:    "2.0",
+				Method: "textDocument/publishDiagnostics",
+			},
+			Params: lsp.PublishDiagnosticsParams{
+				URI:         request.Params.TextDocument.URI,
+				Version:     request.Params.TextDocument.Version,
+				Diagnostics: diagnostics,
+			},
+		})
+
+	case "textDocument/didClose":
+		request, err := parseMessage[lsp.DidCloseTextDocumentNotification](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
 		}
 
+		mh.state.CloseDocument(request.Params.TextDocument.URI)
+		mh.sendMessage(lsp.PublishDiagnosticsNotification{
+			Notification: lsp.Notification{
+				RPC:    "2.0",
+				Method: "textDocument/publishDiagnostics",
+			},
+			Params: lsp.PublishDiagnosticsParams{
+				URI:         request.Params.TextDocument.URI,
+				Diagnostics: []lsp.Diagnostic{},
+			},
+		})
+
 	case "textDocument/hover":
-		request := parseMessage[lsp.HoverRequest](contents, mh.logger, method)
+		request, err := parseMessage[lsp.HoverRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
 
 		response := mh.state.Hover(
+			ctx,
 			request.ID,
 			request.Params.TextDocument.URI,
 			request.Params.Position,
 		)
-		mh.sendMessage(response)
+		mh.sendResponse(ctx, request.ID, response)
 
 	case "textDocument/definition":
-		request := parseMessage[lsp.DefinitionRequest](contents, mh.logger, method)
+		request, err := parseMessage[lsp.DefinitionRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
 
 		response := mh.state.Definition(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Position,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/references":
+		request, err := parseMessage[lsp.ReferencesRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.References(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Position,
+			request.Params.Context.IncludeDeclaration,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/documentHighlight":
+		request, err := parseMessage[lsp.DocumentHighlightRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.DocumentHighlight(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Position,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/documentSymbol":
+		request, err := parseMessage[lsp.DocumentSymbolRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.DocumentSymbol(ctx, request.ID, request.Params.TextDocument.URI)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/foldingRange":
+		request, err := parseMessage[lsp.FoldingRangeRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.FoldingRange(ctx, request.ID, request.Params.TextDocument.URI)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/selectionRange":
+		request, err := parseMessage[lsp.SelectionRangeRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.SelectionRange(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Positions,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/semanticTokens/full":
+		request, err := parseMessage[lsp.SemanticTokensRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.SemanticTokensFull(ctx, request.ID, request.Params.TextDocument.URI)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/semanticTokens/full/delta":
+		request, err := parseMessage[lsp.SemanticTokensDeltaRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.SemanticTokensDelta(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.PreviousResultID,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/formatting":
+		request, err := parseMessage[lsp.DocumentFormattingRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.Formatting(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Options,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/rangeFormatting":
+		request, err := parseMessage[lsp.DocumentRangeFormattingRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.RangeFormatting(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Range,
+			request.Params.Options,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/prepareRename":
+		request, err := parseMessage[lsp.PrepareRenameRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response, err := mh.state.PrepareRename(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Position,
+		)
+		if err != nil {
+			mh.sendRequestError(contents, error_codes.RequestFailed, err.Error())
+			return
+		}
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/rename":
+		request, err := parseMessage[lsp.RenameRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response, err := mh.state.Rename(
+			ctx,
 			request.ID,
 			request.Params.TextDocument.URI,
 			request.Params.Position,
+			request.Params.NewName,
 		)
-		mh.sendMessage(response)
+		if err != nil {
+			mh.sendRequestError(contents, error_codes.RequestFailed, err.Error())
+			return
+		}
+		mh.sendResponse(ctx, request.ID, response)
 
 	case "textDocument/codeAction":
-		request := parseMessage[lsp.CodeActionRequest](contents, mh.logger, method)
+		request, err := parseMessage[lsp.CodeActionRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
 
-		response := mh.state.TextDocumentCodeAction(request.ID, request.Params.TextDocument.URI)
-		mh.sendMessage(response)
+		response := mh.state.TextDocumentCodeAction(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+		)
+		mh.sendResponse(ctx, request.ID, response)
 
 	case "textDocument/completion":
-		request := parseMessage[lsp.CompletionRequest](contents, mh.logger, method)
-		mh.logger.Println(request.Params.Position.Line)
+		request, err := parseMessage[lsp.CompletionRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
 
 		response := mh.state.TextDocumentCompletion(
+			ctx,
 			request.ID,
 			request.Params.Position,
 			request.Params.TextDocument.URI,
 		)
-		mh.sendMessage(response)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "textDocument/signatureHelp":
+		request, err := parseMessage[lsp.SignatureHelpRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		response := mh.state.SignatureHelp(
+			ctx,
+			request.ID,
+			request.Params.TextDocument.URI,
+			request.Params.Position,
+		)
+		mh.sendResponse(ctx, request.ID, response)
+
+	case "workspace/executeCommand":
+		request, err := parseMessage[lsp.ExecuteCommandRequest](contents)
+		if err != nil {
+			mh.sendParseMessageError(contents, method, err)
+			return
+		}
+
+		result, err := mh.state.ExecuteCommand(
+			ctx,
+			request.ID,
+			request.Params.Command,
+			request.Params.Arguments,
+			logWriter{mh: mh},
+		)
+		if err != nil {
+			mh.sendRequestError(contents, error_codes.RequestFailed, err.Error())
+			return
+		}
+
+		// The document may have changed while the program ran, diagnostics of
+		// the old version would replace the newer ones
+		published := mh.state.WhileCurrent(result.URI, result.Version, func() {
+			mh.sendMessage(lsp.PublishDiagnosticsNotification{
+				Notification: lsp.Notification{
+					RPC:    "2.0",
+					Method: "textDocument/publishDiagnostics",
+				},
+				Params: lsp.PublishDiagnosticsParams{
+					URI:         result.URI,
+					Version:     result.Version,
+					Diagnostics: result.Diagnostics,
+				},
+			})
+		})
+		if !published {
+			mh.logger.Printf("Dropped diagnostics of a run of %s, the document changed", result.URI)
+		}
+		mh.sendResponse(ctx, request.ID, result.Response)
+
+	default:
+		// Notifications starting with `$/` are optional and can be ignored,
+		// requests still have to be answered
+		if _, isRequest := requestID(contents); strings.HasPrefix(method, "$/") && !isRequest {
+			return
+		}
+
+		mh.sendRequestError(
+			contents,
+			error_codes.MethodNotFound,
+			fmt.Sprintf("Method \"%s\" not found", method),
+		)
+	}
+}
+
+// HandleDecodeError answers a message whose content couldn't be decoded. The
+// id of such message is unknown, so the response is sent with a null id.
+// Framing errors are only logged, the broken message can't be told apart from
+// the ones around it, so there's nothing to answer.
+func (mh *MessageHandler) HandleDecodeError(err error) {
+	mh.logger.Printf("Couldn't decode message: %s", err)
+
+	if errors.Is(err, rpc.ErrMalformedContent) {
+		mh.sendMessage(lsp.NewErrorResponse(nil, error_codes.ParseError, err.Error()))
 	}
 }
 
 func (mh *MessageHandler) sendMessage(msg any) {
 	reply := rpc.EncodeMessage(msg)
+
+	mh.writeMu.Lock()
+	defer mh.writeMu.Unlock()
+
 	mh.writer.Write([]byte(reply))
 }
 
-func parseMessage[T any](contents []byte, logger *log.Logger, method string) T {
+// logWriter sends everything written to it to the client as log messages, so
+// output of a running program shows up as it's printed.
+type logWriter struct {
+	mh *MessageHandler
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.mh.sendMessage(lsp.LogMessageNotification{
+		Notification: lsp.Notification{
+			RPC:    "2.0",
+			Method: "window/logMessage",
+		},
+		Params: lsp.LogMessageParams{
+			Type:    message_type.Log,
+			Message: strings.TrimSuffix(string(p), "\n"),
+		},
+	})
+
+	return len(p), nil
+}
+
+// sendResponse replaces the response of a cancelled request with RequestCancelled.
+func (mh *MessageHandler) sendResponse(ctx context.Context, id int, response any) {
+	if ctx.Err() != nil {
+		mh.sendMessage(lsp.NewErrorResponse(&id, error_codes.RequestCancelled, "Request cancelled"))
+		return
+	}
+
+	mh.sendMessage(response)
+}
+
+// sendRequestError responds with an error if the message is a request,
+// notifications can't be responded to so the error is only logged.
+func (mh *MessageHandler) sendRequestError(contents []byte, code int, message string) {
+	id, ok := requestID(contents)
+	if !ok {
+		mh.logger.Printf("Dropping notification error (%d): %s", code, message)
+		return
+	}
+
+	mh.sendMessage(lsp.NewErrorResponse(&id, code, message))
+}
+
+func (mh *MessageHandler) sendParseMessageError(contents []byte, method string, err error) {
+	mh.logger.Printf("Couldn't parse message (%s) in \"%s\"\n", err, method)
+	mh.sendRequestError(contents, error_codes.InvalidParams, err.Error())
+}
+
+func parseMessage[T any](contents []byte) (T, error) {
 	var request T
-	if err := json.Unmarshal(contents, &request); err != nil {
-		logger.Printf("Couldn't parse message (%s) in \"%s\"\n", err, method)
+	err := json.Unmarshal(contents, &request)
+	return request, err
+}
+
+func requestID(contents []byte) (int, bool) {
+	var message struct {
+		ID *int `json:"id"`
+	}
+	if err := json.Unmarshal(contents, &message); err != nil || message.ID == nil {
+		return 0, false
 	}
-	return request
+	return *message.ID, true
 }
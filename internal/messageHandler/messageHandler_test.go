@@ -0,0 +1,289 @@
+package messageHandler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/analysis"
+	"github.com/marcsek/monkey-language-server/internal/rpc"
+)
+
+var (
+	buff       bytes.Buffer
+	MockLogger = log.New(&buff, "", log.LstdFlags)
+)
+
+func TestLifecycle(t *testing.T) {
+	tests := []struct {
+		shutdown     bool
+		expectedCode int
+	}{
+		{shutdown: true, expectedCode: 0},
+		{shutdown: false, expectedCode: 1},
+	}
+
+	for _, tt := range tests {
+		var writer bytes.Buffer
+		mh := New(nil, &writer, analysis.NewState(MockLogger), MockLogger)
+
+		exitCode := -1
+		mh.exit = func(code int) { exitCode = code }
+
+		if tt.shutdown {
+			mh.HandleMessage(context.Background(), "shutdown", []byte(`{"jsonrpc":"2.0","id":1,"method":"shutdown"}`))
+
+			if !strings.Contains(writer.String(), `{"jsonrpc":"2.0","id":1,"result":null}`) {
+				t.Fatalf("Wrong shutdown response, got=%s", writer.String())
+			}
+			writer.Reset()
+
+			mh.HandleMessage(context.Background(),
+				"textDocument/hover",
+				[]byte(`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover"}`),
+			)
+			if !strings.Contains(writer.String(), `"id":2,"error":{"code":-32600`) {
+				t.Fatalf("Request after shutdown should fail, got=%s", writer.String())
+			}
+			writer.Reset()
+
+			mh.HandleMessage(context.Background(), "initialized", []byte(`{"jsonrpc":"2.0","method":"initialized"}`))
+			if writer.Len() != 0 {
+				t.Fatalf("Notification after shutdown should be dropped, got=%s", writer.String())
+			}
+		}
+
+		mh.HandleMessage(context.Background(), "exit", []byte(`{"jsonrpc":"2.0","method":"exit"}`))
+		if exitCode != tt.expectedCode {
+			t.Fatalf("Wrong exit code, want=%d; got=%d", tt.expectedCode, exitCode)
+		}
+	}
+}
+
+func TestDidCloseFreesDocument(t *testing.T) {
+	var writer bytes.Buffer
+	state := analysis.NewState(MockLogger)
+	mh := New(nil, &writer, state, MockLogger)
+
+	mh.HandleMessage(context.Background(), "textDocument/didOpen", []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen",
+		"params":{"textDocument":{"uri":"file:///a.monkey","version":1,"text":"x"}}}`))
+	if _, ok := state.Documents["file:///a.monkey"]; !ok {
+		t.Fatalf("Document wasn't opened")
+	}
+	writer.Reset()
+
+	mh.HandleMessage(context.Background(), "textDocument/didClose", []byte(`{"jsonrpc":"2.0","method":"textDocument/didClose",
+		"params":{"textDocument":{"uri":"file:///a.monkey"}}}`))
+	if _, ok := state.Documents["file:///a.monkey"]; ok {
+		t.Fatalf("Document wasn't freed on close")
+	}
+
+	if !strings.Contains(writer.String(), `"diagnostics":[]`) {
+		t.Fatalf("Diagnostics weren't cleared on close, got=%s", writer.String())
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		method   string
+		contents string
+		expected string
+	}{
+		{
+			"textDocument/unknown",
+			`{"jsonrpc":"2.0","id":1,"method":"textDocument/unknown"}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,`,
+		},
+		{
+			"unknown/notification",
+			`{"jsonrpc":"2.0","method":"unknown/notification"}`,
+			``,
+		},
+		{
+			"$/setTrace",
+			`{"jsonrpc":"2.0","method":"$/setTrace"}`,
+			``,
+		},
+		{
+			"$/unknownRequest",
+			`{"jsonrpc":"2.0","id":2,"method":"$/unknownRequest"}`,
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-32601,`,
+		},
+		{
+			"textDocument/hover",
+			`{"jsonrpc":"2.0","id":3,"method":"textDocument/hover","params":{"position":"0:0"}}`,
+			`{"jsonrpc":"2.0","id":3,"error":{"code":-32602,`,
+		},
+	}
+
+	for _, tt := range tests {
+		var writer bytes.Buffer
+		mh := New(nil, &writer, analysis.NewState(MockLogger), MockLogger)
+
+		mh.HandleMessage(context.Background(), tt.method, []byte(tt.contents))
+
+		if tt.expected == "" && writer.Len() != 0 {
+			t.Fatalf("Expected no response for %s, got=%s", tt.method, writer.String())
+		}
+
+		if !strings.Contains(writer.String(), tt.expected) {
+			t.Fatalf("Wrong response for %s, want=%s; got=%s", tt.method, tt.expected, writer.String())
+		}
+	}
+}
+
+func TestPanicBecomesInternalError(t *testing.T) {
+	var writer bytes.Buffer
+	mh := New(nil, &writer, nil, MockLogger)
+
+	mh.HandleMessage(context.Background(), "textDocument/hover", []byte(`{"jsonrpc":"2.0","id":4,"method":"textDocument/hover"}`))
+
+	if !strings.Contains(writer.String(), `{"jsonrpc":"2.0","id":4,"error":{"code":-32603,`) {
+		t.Fatalf("Wrong response after panic, got=%s", writer.String())
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{
+			fmt.Errorf("%w: broken", rpc.ErrMalformedContent),
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"malformed content: broken"}}`,
+		},
+		{rpc.ErrMissingContentLength, ``},
+		{fmt.Errorf("%w: \"x\"", rpc.ErrInvalidContentLength), ``},
+		{fmt.Errorf("%w: \"x\"", rpc.ErrMalformedHeader), ``},
+	}
+
+	for _, tt := range tests {
+		var writer bytes.Buffer
+		mh := New(nil, &writer, analysis.NewState(MockLogger), MockLogger)
+
+		mh.HandleDecodeError(tt.err)
+
+		if tt.expected == "" && writer.Len() != 0 {
+			t.Fatalf("Framing error %q shouldn't be answered, got=%s", tt.err, writer.String())
+		}
+
+		if !strings.Contains(writer.String(), tt.expected) {
+			t.Fatalf("Wrong response for %q, want=%s; got=%s", tt.err, tt.expected, writer.String())
+		}
+	}
+}
+
+func TestDispatchOrdersNotificationsBeforeRequests(t *testing.T) {
+	var writer bytes.Buffer
+	mh := New(nil, &writer, analysis.NewState(MockLogger), MockLogger)
+
+	mh.Dispatch("textDocument/didOpen", []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen",
+		"params":{"textDocument":{"uri":"file:///a.monkey","version":1,"text":"let opened = 1;"}}}`))
+	mh.Dispatch("textDocument/completion", []byte(`{"jsonrpc":"2.0","id":1,"method":"textDocument/completion",
+		"params":{"textDocument":{"uri":"file:///a.monkey"},"position":{"line":0,"character":0}}}`))
+	mh.Dispatch("textDocument/didChange", []byte(`{"jsonrpc":"2.0","method":"textDocument/didChange",
+		"params":{"textDocument":{"uri":"file:///a.monkey","version":2},"contentChanges":[{"text":"let changed = 1;"}]}}`))
+	mh.Dispatch("textDocument/completion", []byte(`{"jsonrpc":"2.0","id":2,"method":"textDocument/completion",
+		"params":{"textDocument":{"uri":"file:///a.monkey"},"position":{"line":0,"character":0}}}`))
+	mh.Wait()
+
+	if strings.Count(writer.String(), `"id":`) != 2 {
+		t.Fatalf("Expected 2 responses, got=%s", writer.String())
+	}
+
+	// Each request sees the document as it was when it arrived
+	first := response(writer.String(), 1)
+	if !strings.Contains(first, `"label":"opened"`) || strings.Contains(first, `"label":"changed"`) {
+		t.Fatalf("First completion should see only the opened document, got=%s", first)
+	}
+
+	second := response(writer.String(), 2)
+	if !strings.Contains(second, `"label":"changed"`) || strings.Contains(second, `"label":"opened"`) {
+		t.Fatalf("Second completion should see only the changed document, got=%s", second)
+	}
+}
+
+// response returns the content of the message with the id from the output.
+func response(output string, id int) string {
+	for _, message := range strings.Split(output, "Content-Length:") {
+		if strings.Contains(message, fmt.Sprintf(`"id":%d,`, id)) {
+			return message
+		}
+	}
+	return ""
+}
+
+func TestCancelledRequest(t *testing.T) {
+	var writer bytes.Buffer
+	mh := New(nil, &writer, analysis.NewState(MockLogger), MockLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mh.HandleMessage(ctx, "textDocument/completion", []byte(`{"jsonrpc":"2.0","id":7,"method":"textDocument/completion",
+		"params":{"textDocument":{"uri":"file:///a.monkey"},"position":{"line":0,"character":0}}}`))
+
+	if !strings.Contains(writer.String(), `{"jsonrpc":"2.0","id":7,"error":{"code":-32800,`) {
+		t.Fatalf("Wrong response for cancelled request, got=%s", writer.String())
+	}
+
+	// Cancelling a request that isn't pending must not fail
+	mh.Dispatch("$/cancelRequest", []byte(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":7}}`))
+}
+
+func TestCancelRunningRequest(t *testing.T) {
+	var writer bytes.Buffer
+	mh := New(nil, &writer, analysis.NewState(MockLogger), MockLogger)
+
+	// Without the cancel the run takes until a limit stops it
+	mh.Dispatch("textDocument/didOpen", []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen",
+		"params":{"textDocument":{"uri":"file:///a.monkey","version":1,
+		"text":"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(60)"}}}`))
+	mh.Dispatch("workspace/executeCommand", []byte(`{"jsonrpc":"2.0","id":1,"method":"workspace/executeCommand",
+		"params":{"command":"monkey.runFile","arguments":["file:///a.monkey"]}}`))
+	mh.Dispatch("$/cancelRequest", []byte(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":1}}`))
+	mh.Wait()
+
+	if !strings.Contains(writer.String(), `{"jsonrpc":"2.0","id":1,"error":{"code":-32800,`) {
+		t.Fatalf("Wrong response for cancelled request, got=%s", writer.String())
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	var writer bytes.Buffer
+	state := analysis.NewState(MockLogger)
+	mh := New(nil, &writer, state, MockLogger)
+
+	mh.HandleMessage(context.Background(), "textDocument/didOpen", []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen",
+		"params":{"textDocument":{"uri":"file:///a.monkey","version":1,"text":"puts(\"hi\");\n1 / 0"}}}`))
+	writer.Reset()
+
+	mh.HandleMessage(context.Background(), "workspace/executeCommand", []byte(`{"jsonrpc":"2.0","id":1,"method":"workspace/executeCommand",
+		"params":{"command":"monkey.runFile","arguments":["file:///a.monkey"]}}`))
+
+	output := writer.String()
+	expected := []string{
+		`"method":"window/logMessage","params":{"type":4,"message":"hi"}`,
+		`"code":"runtime-error","source":"monkey-lsp","message":"division by zero"`,
+		`{"jsonrpc":"2.0","id":1,"result":null}`,
+	}
+
+	last := -1
+	for _, e := range expected {
+		index := strings.Index(output, e)
+		if index == -1 || index < last {
+			t.Fatalf("Missing or misplaced %s, got=%s", e, output)
+		}
+		last = index
+	}
+	writer.Reset()
+
+	mh.HandleMessage(context.Background(), "workspace/executeCommand", []byte(`{"jsonrpc":"2.0","id":2,"method":"workspace/executeCommand",
+		"params":{"command":"monkey.unknown","arguments":[]}}`))
+	if !strings.Contains(writer.String(), `"id":2,"error":{"code":-32803`) {
+		t.Fatalf("Unknown command should fail, got=%s", writer.String())
+	}
+}
@@ -24,6 +24,15 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+
+	// RangeValue spans the whole source, so unlike the statements it covers
+	// comments and whitespace around them too
+	RangeValue token.Range
+
+	// Comments holds every comment of the source in order, Dangling are the
+	// ones after the last statement
+	Comments []token.Comment
+	Dangling []token.Comment
 }
 
 func (p *Program) TokenLiteral() string {
@@ -34,18 +43,7 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
-func (p *Program) Range() token.Range {
-	if len(p.Statements) == 0 {
-		return token.Range{}
-	} else if len(p.Statements) == 1 {
-		return p.Statements[0].Range()
-	} else {
-		return token.Range{
-			Start: p.Statements[0].Range().Start,
-			End:   p.Statements[len(p.Statements)-1].Range().End,
-		}
-	}
-}
+func (p *Program) Range() token.Range { return p.RangeValue }
 
 func (p *Program) String() string {
 	var sb strings.Builder
@@ -57,11 +55,24 @@ func (p *Program) String() string {
 	return sb.String()
 }
 
+// Trivia are the comments kept on a statement.
+type Trivia struct {
+	// Leading are the comments above the statement, Trailing the ones after it
+	// on its last line
+	Leading  []token.Comment
+	Trailing []token.Comment
+
+	// Inner are the comments in the statement that aren't attached to any of
+	// its nested statements, like comments between elements of an array
+	Inner []token.Comment
+}
+
 type LetStatement struct {
 	Token      token.Token
 	Name       *Identifier
 	Value      Expression
 	RangeValue token.Range
+	Trivia
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -99,6 +110,7 @@ type ReturnStatement struct {
 	Token       token.Token
 	RangeValue  token.Range
 	ReturnValue Expression
+	Trivia
 }
 
 func (rs *ReturnStatement) statementNode()       {}
@@ -122,6 +134,7 @@ type ExpressionStatement struct {
 	Token      token.Token
 	RangeValue token.Range
 	Expression Expression
+	Trivia
 }
 
 func (es *ExpressionStatement) statementNode()       {}
@@ -242,6 +255,9 @@ type BlockStatement struct {
 	Token      token.Token
 	RangeValue token.Range
 	Statements []Statement
+
+	// Dangling are the comments after the last statement of the block
+	Dangling []token.Comment
 }
 
 func (bs *BlockStatement) expressionNode()      {}
@@ -383,3 +399,28 @@ func (hl *HashLiteral) String() string {
 
 	return sb.String()
 }
+
+// BadStatement is a placeholder for a statement that couldn't be parsed. It
+// spans all tokens skipped while the parser was recovering.
+type BadStatement struct {
+	Token      token.Token
+	RangeValue token.Range
+	Trivia
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) Range() token.Range   { return bs.RangeValue }
+func (bs *BadStatement) String() string       { return "" }
+
+// BadExpression is a placeholder for an expression that couldn't be parsed,
+// so that the surrounding node can still be kept in the tree.
+type BadExpression struct {
+	Token      token.Token
+	RangeValue token.Range
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) Range() token.Range   { return be.RangeValue }
+func (be *BadExpression) String() string       { return "" }
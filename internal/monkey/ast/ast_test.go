@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/marcsek/monkey-language-server/internal/monkey/token"
@@ -27,3 +28,50 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestInspect(t *testing.T) {
+	ident := func(name string, character int) *Identifier {
+		rng := token.Range{
+			Start: token.Position{Line: 0, Character: character},
+			End:   token.Position{Line: 0, Character: character + len(name)},
+		}
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name, RangeValue: rng}
+	}
+
+	// let a = b + c;
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("a", 4),
+				Value: &InfixExpression{
+					Left:     ident("b", 8),
+					Operator: "+",
+					Right:    ident("c", 12),
+				},
+			},
+			&ExpressionStatement{Expression: &IfExpression{Condition: ident("d", 16)}},
+		},
+	}
+
+	visited := []string{}
+	Inspect(program, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			visited = append(visited, ident.Value)
+		}
+		return true
+	})
+
+	if strings.Join(visited, "") != "abcd" {
+		t.Errorf("Inspect visited identifiers in wrong order. got=%q", visited)
+	}
+
+	found := IdentifierAt(program, token.Position{Line: 0, Character: 13})
+	if found == nil || found.Value != "c" {
+		t.Errorf("IdentifierAt returned wrong identifier. got=%v", found)
+	}
+
+	if found := IdentifierAt(program, token.Position{Line: 0, Character: 10}); found != nil {
+		t.Errorf("IdentifierAt should not find an identifier. got=%v", found)
+	}
+}
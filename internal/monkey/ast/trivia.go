@@ -0,0 +1,58 @@
+package ast
+
+import "github.com/marcsek/monkey-language-server/internal/monkey/token"
+
+// StatementTrivia returns the comments kept on a statement, or nil for
+// statements that don't keep any.
+func StatementTrivia(s Statement) *Trivia {
+	switch s := s.(type) {
+	case *LetStatement:
+		return &s.Trivia
+	case *ReturnStatement:
+		return &s.Trivia
+	case *ExpressionStatement:
+		return &s.Trivia
+	case *BadStatement:
+		return &s.Trivia
+	}
+	return nil
+}
+
+// HasComments reports whether any comments are attached to the statement.
+func (t *Trivia) HasComments() bool {
+	return len(t.Leading) > 0 || len(t.Trailing) > 0 || len(t.Inner) > 0
+}
+
+// FullRange returns the range of a statement extended over its leading and
+// trailing comments.
+func FullRange(s Statement) token.Range {
+	r := s.Range()
+
+	trivia := StatementTrivia(s)
+	if trivia == nil {
+		return r
+	}
+
+	if len(trivia.Leading) > 0 {
+		r.Start = trivia.Leading[0].Range.Start
+	}
+	if len(trivia.Trailing) > 0 {
+		r.End = trivia.Trailing[len(trivia.Trailing)-1].Range.End
+	}
+
+	return r
+}
+
+// DocComment returns the comments directly above the statement, without blank
+// lines between them and the statement.
+func (t *Trivia) DocComment(statementStart token.Position) []token.Comment {
+	line := statementStart.Line
+
+	i := len(t.Leading)
+	for i > 0 && t.Leading[i-1].Range.End.Line >= line-1 {
+		i--
+		line = t.Leading[i].Range.Start.Line
+	}
+
+	return t.Leading[i:]
+}
@@ -0,0 +1,137 @@
+package ast
+
+import (
+	"sort"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// Inspect traverses the tree in depth-first order, calling f for every node.
+// Children of a node are skipped when f returns false. Nil children, which
+// can be left behind by parser recovery, are skipped too.
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Inspect(child, f)
+	}
+}
+
+// Children returns direct children of a node in source order.
+func Children(node Node) []Node {
+	children := []Node{}
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if !isNil(n) {
+				children = append(children, n)
+			}
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *LetStatement:
+		add(node.Name, node.Value)
+	case *ReturnStatement:
+		add(node.ReturnValue)
+	case *ExpressionStatement:
+		add(node.Expression)
+	case *PrefixExpression:
+		add(node.Right)
+	case *InfixExpression:
+		add(node.Left, node.Right)
+	case *IfExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			add(p)
+		}
+		add(node.Body)
+	case *CallExpression:
+		add(node.Function)
+		for _, a := range node.Arguments {
+			add(a)
+		}
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			add(e)
+		}
+	case *IndexExpression:
+		add(node.Left, node.Index)
+	case *HashLiteral:
+		for _, key := range node.SortedKeys() {
+			add(key, node.Pairs[key])
+		}
+	}
+
+	return children
+}
+
+// SortedKeys returns keys of the hash in the order they appear in the source.
+func (hl *HashLiteral) SortedKeys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Range().Start.Before(keys[j].Range().Start)
+	})
+
+	return keys
+}
+
+// IdentifierAt returns the innermost identifier whose range contains the position.
+func IdentifierAt(node Node, position token.Position) *Identifier {
+	var found *Identifier
+
+	Inspect(node, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok && ident.Range().Contains(position) {
+			found = ident
+		}
+		return true
+	})
+
+	return found
+}
+
+// Span is the range covering the node and all of its descendants. It differs
+// from the node's own range for calls and index expressions, which start at
+// their bracket.
+func Span(node Node) token.Range {
+	span := node.Range()
+
+	Inspect(node, func(n Node) bool {
+		r := n.Range()
+		if r.Start.Before(span.Start) {
+			span.Start = r.Start
+		}
+		if span.End.Before(r.End) {
+			span.End = r.End
+		}
+		return true
+	})
+
+	return span
+}
+
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return node == nil
+	case *BlockStatement:
+		return node == nil
+	}
+	return false
+}
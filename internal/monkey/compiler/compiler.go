@@ -9,6 +9,7 @@ import (
 	"github.com/marcsek/monkey-language-server/internal/lsp"
 	"github.com/marcsek/monkey-language-server/internal/lsp/CompletionItemKind"
 	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/code"
 	"github.com/marcsek/monkey-language-server/internal/monkey/object"
 	"github.com/marcsek/monkey-language-server/internal/monkey/token"
 )
@@ -17,23 +18,51 @@ type Compiler struct {
 	symbolTable    *SymbolTable
 	symbolTableMap map[string]*SymbolTable
 	logger         *log.Logger
+	errors         []CompilerError
 
+	// resolved maps every identifier in the program, including the defining
+	// ones, to the symbol it refers to
+	resolved   map[*ast.Identifier]Symbol
+	references map[binding][]Reference
+
+	constants  []object.Object
+	scopes     []CompilationScope
 	scopeIndex int
 }
 
 func New(logger *log.Logger) *Compiler {
 	symbolTable := NewSymbolTable(token.Range{})
-	symbolTableMap := make(map[string]*SymbolTable)
 
+	for i, name := range object.Builtins {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	return NewWithState(logger, symbolTable, []object.Object{})
+}
+
+// NewWithState continues with globals and constants of a previous compilation,
+// so programs can be compiled piece by piece, like lines of a REPL.
+func NewWithState(logger *log.Logger, symbolTable *SymbolTable, constants []object.Object) *Compiler {
 	return &Compiler{
 		symbolTable:    symbolTable,
-		symbolTableMap: symbolTableMap,
+		symbolTableMap: make(map[string]*SymbolTable),
+		constants:      constants,
+		scopes:         []CompilationScope{{instructions: code.Instructions{}}},
 		scopeIndex:     0,
+		errors:         []CompilerError{},
+		resolved:       map[*ast.Identifier]Symbol{},
+		references:     map[binding][]Reference{},
 
 		logger: logger,
 	}
 }
 
+// Errors returns semantic errors collected during Compile. Unlike the error
+// returned from Compile, these don't stop the walk.
+func (c *Compiler) Errors() []CompilerError {
+	return c.errors
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
@@ -49,15 +78,51 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		c.emit(code.OpPop)
 
 	case *ast.LetStatement:
-		c.symbolTable.Define(node.Name.Value)
+		// Only functions can refer to their own name, other values would read
+		// the binding before it's set
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+
+		var symbol Symbol
+		if isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value, node.Name.Range())
+			c.recordReference(node.Name, symbol, true)
+		}
+
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
 
-	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		if !isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value, node.Name.Range())
+			c.recordReference(node.Name, symbol, true)
+		}
+
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.BadExpression, *ast.BadStatement:
 		return nil
 
 	case *ast.PrefixExpression:
@@ -65,7 +130,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
-		return nil
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
 
 	case *ast.InfixExpression:
 		if node.Operator == "<" {
@@ -79,6 +152,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
+			c.emit(code.OpGreaterThan)
 			return nil
 		}
 
@@ -92,24 +166,55 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
 			return err
 		}
 
+		// Jump targets aren't known yet, they are patched below
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
 		err = c.Compile(node.Consequence)
 		if err != nil {
 			return err
 		}
+		c.blockValue()
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
 
 		if node.Alternative != nil {
 			err = c.Compile(node.Alternative)
 			if err != nil {
 				return err
 			}
+			c.blockValue()
+		} else {
+			c.emit(code.OpNull)
 		}
 
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -119,10 +224,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.Identifier:
-		_, ok := c.symbolTable.Resolve(node.Value)
+		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			c.addError(UndefinedVariable, node.Range(), "undefined variable %s", node.Value)
+			return nil
 		}
+		c.recordReference(node, symbol, false)
+		c.loadSymbol(symbol)
 
 	case *ast.ArrayLiteral:
 		for _, s := range node.Elements {
@@ -132,6 +240,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
+		c.emit(code.OpArray, len(node.Elements))
+
 	case *ast.HashLiteral:
 		keys := []ast.Expression{}
 		for k := range node.Pairs {
@@ -154,6 +264,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -165,30 +277,59 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		c.emit(code.OpIndex)
+
 	case *ast.FunctionLiteral:
-		c.enterScope(node.Body.Range())
+		// The name comes from the enclosing let statement, which is already defined
+		nameSymbol, hasName := c.symbolTable.store[node.Name]
 
-		defer c.leaveScope()
+		c.enterScope(node.Body.Range())
 
-		if node.Name != "" {
-			c.symbolTable.DefineFunctionName(node.Name)
+		if node.Name != "" && hasName {
+			c.symbolTable.DefineFunctionName(node.Name, nameSymbol.Range)
 		}
 
 		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+			c.recordReference(p, c.symbolTable.Define(p.Value, p.Range()), true)
 		}
 
 		err := c.Compile(node.Body)
 		if err != nil {
+			c.leaveScope()
 			return err
 		}
 
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		instructions := c.leaveScope()
+
+		// Captured values are pushed for OpClosure to collect them
+		for _, s := range freeSymbols {
+			c.loadSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+		}
+		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
 
+		c.emit(code.OpReturnValue)
+
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
 		if err != nil {
@@ -202,6 +343,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
+		c.emit(code.OpCall, len(node.Arguments))
+
 	default:
 		return fmt.Errorf("unknown operator %s", node.TokenLiteral())
 	}
@@ -209,14 +352,31 @@ func (c *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+// ResolveIdentifier returns the symbol an identifier refers to. Defining
+// identifiers (let names and parameters) resolve to the symbol they define.
+func (c *Compiler) ResolveIdentifier(ident *ast.Identifier) (Symbol, bool) {
+	symbol, ok := c.resolved[ident]
+	return symbol, ok
+}
+
 func (c *Compiler) enterScope(tableRange token.Range) {
-	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable, tableRange)
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
 
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable, tableRange)
 }
 
-func (c *Compiler) leaveScope() {
+// leaveScope returns instructions of the scope that was left.
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
 	c.symbolTableMap[c.symbolTable.tableRange.String()] = c.symbolTable
 	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
 }
 
 func (c *Compiler) Completion(position token.Position) []lsp.CompletionItem {
@@ -236,8 +396,11 @@ func (c *Compiler) Completion(position token.Position) []lsp.CompletionItem {
 		items = append(items, lsp.CompletionItem{Label: name, Kind: completion_item_kind.Keyword})
 	}
 
-	st := c.findMostSpecificScope(position)
-	for _, symbol := range st.ResolveAll() {
+	for _, symbol := range c.VisibleSymbols(position) {
+		if symbol.Scope == BuiltinScope {
+			continue
+		}
+
 		kind := completion_item_kind.Variable
 		if symbol.Scope == FunctionScope {
 			kind = completion_item_kind.Function
@@ -254,6 +417,12 @@ func (c *Compiler) Completion(position token.Position) []lsp.CompletionItem {
 	return items
 }
 
+// VisibleSymbols returns every symbol that can be referenced at the position,
+// builtins included.
+func (c *Compiler) VisibleSymbols(position token.Position) []Symbol {
+	return c.findMostSpecificScope(position).ResolveAll()
+}
+
 func (c *Compiler) findMostSpecificScope(position token.Position) *SymbolTable {
 	mostSpecific := c.symbolTable
 	depth := c.symbolTable.depth
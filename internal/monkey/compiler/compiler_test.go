@@ -9,7 +9,9 @@ import (
 	"github.com/marcsek/monkey-language-server/internal/lsp"
 	completion_item_kind "github.com/marcsek/monkey-language-server/internal/lsp/CompletionItemKind"
 	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/code"
 	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
 	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
 	"github.com/marcsek/monkey-language-server/internal/monkey/token"
 )
@@ -88,6 +90,353 @@ func TestCompletion(t *testing.T) {
 	)
 }
 
+func TestUndefinedVariables(t *testing.T) {
+	input := `let a = b + 1;
+let f = fn(x) { x + y };
+len(a);
+f(z, a);`
+
+	expected := []struct {
+		message string
+		rng     token.Range
+	}{
+		{"undefined variable b", token.Range{
+			Start: token.Position{Line: 0, Character: 8},
+			End:   token.Position{Line: 0, Character: 9},
+		}},
+		{"undefined variable y", token.Range{
+			Start: token.Position{Line: 1, Character: 20},
+			End:   token.Position{Line: 1, Character: 21},
+		}},
+		{"undefined variable z", token.Range{
+			Start: token.Position{Line: 3, Character: 2},
+			End:   token.Position{Line: 3, Character: 3},
+		}},
+	}
+
+	compiler, err := runCompiler(compilerTestCase{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errors := compiler.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("Wrong number of errors, want=%d; got=%d (%v)", len(expected), len(errors), errors)
+	}
+
+	for i, exp := range expected {
+		if errors[i].Message != exp.message {
+			t.Fatalf("Wrong error message, want=%s; got=%s", exp.message, errors[i].Message)
+		}
+
+		if errors[i].Range != exp.rng {
+			t.Fatalf("Wrong error range, want=%s; got=%s", exp.rng, errors[i].Range)
+		}
+
+		if errors[i].Code != UndefinedVariable {
+			t.Fatalf("Wrong error code, want=%s; got=%s", UndefinedVariable, errors[i].Code)
+		}
+	}
+}
+
+func TestResolveIdentifier(t *testing.T) {
+	input := `let x = 1;
+let f = fn(a) {
+  let g = fn() { a + x };
+  let x = 2;
+  f(x)
+};
+len(x);`
+
+	tests := []struct {
+		position      token.Position
+		expectedScope SymbolScope
+		expectedRange token.Range
+	}{
+		{token.Position{Line: 2, Character: 17}, FreeScope, createRange(1, 11, 1)},
+		{token.Position{Line: 2, Character: 21}, GlobalScope, createRange(0, 4, 1)},
+		{token.Position{Line: 4, Character: 4}, LocalScope, createRange(3, 6, 1)},
+		{token.Position{Line: 4, Character: 2}, FunctionScope, createRange(1, 4, 1)},
+		{token.Position{Line: 1, Character: 11}, LocalScope, createRange(1, 11, 1)},
+		{token.Position{Line: 6, Character: 0}, BuiltinScope, token.Range{}},
+		{token.Position{Line: 6, Character: 4}, GlobalScope, createRange(0, 4, 1)},
+	}
+
+	program := parse(input)
+	compiler := New(MockLogger)
+	if err := compiler.Compile(program); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		ident := ast.IdentifierAt(program, tt.position)
+		if ident == nil {
+			t.Fatalf("No identifier at %v", tt.position)
+		}
+
+		symbol, ok := compiler.ResolveIdentifier(ident)
+		if !ok {
+			t.Fatalf("Identifier %s at %v wasn't resolved", ident.Value, tt.position)
+		}
+
+		if symbol.Scope != tt.expectedScope {
+			t.Fatalf("Wrong scope of %s at %v, want=%s; got=%s",
+				ident.Value, tt.position, tt.expectedScope, symbol.Scope)
+		}
+
+		if symbol.Range != tt.expectedRange {
+			t.Fatalf("Wrong definition of %s at %v, want=%s; got=%s",
+				ident.Value, tt.position, tt.expectedRange, symbol.Range)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	input := `let x = 1;
+let f = fn(x) { x + 1 };
+let g = fn() { let h = fn() { x + y }; let y = x; };
+x < f(x);`
+
+	tests := []struct {
+		position token.Position
+		expected []token.Range
+	}{
+		{token.Position{Line: 0, Character: 4}, []token.Range{
+			createRange(0, 4, 1), createRange(2, 30, 1), createRange(2, 47, 1),
+			createRange(3, 0, 1), createRange(3, 6, 1),
+		}},
+		{token.Position{Line: 1, Character: 16}, []token.Range{
+			createRange(1, 11, 1), createRange(1, 16, 1),
+		}},
+		{token.Position{Line: 3, Character: 4}, []token.Range{
+			createRange(1, 4, 1), createRange(3, 4, 1),
+		}},
+	}
+
+	program := parse(input)
+	compiler := New(MockLogger)
+	if err := compiler.Compile(program); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		ident := ast.IdentifierAt(program, tt.position)
+		symbol, ok := compiler.ResolveIdentifier(ident)
+		if !ok {
+			t.Fatalf("Identifier at %v wasn't resolved", tt.position)
+		}
+
+		references := compiler.References(symbol)
+		if len(references) != len(tt.expected) {
+			t.Fatalf("Wrong number of references at %v, want=%d; got=%d",
+				tt.position, len(tt.expected), len(references))
+		}
+
+		for i, expected := range tt.expected {
+			if references[i].Identifier.Range() != expected {
+				t.Fatalf("Wrong reference at %v, want=%s; got=%s",
+					tt.position, expected, references[i].Identifier.Range())
+			}
+
+			if references[i].IsDefinition != (i == 0) {
+				t.Fatalf("Only the first reference should be a definition")
+			}
+		}
+	}
+}
+
+func TestValidateRename(t *testing.T) {
+	input := `let x = 1;
+let f = fn(a) { let y = a; fn(b) { x + b } };
+let z = fn() { let w = 2; w };`
+
+	tests := []struct {
+		position token.Position
+		newName  string
+		valid    bool
+	}{
+		{token.Position{Line: 0, Character: 4}, "renamed", true},
+		{token.Position{Line: 0, Character: 4}, "x", true},
+		{token.Position{Line: 0, Character: 4}, "fn", false},
+		{token.Position{Line: 0, Character: 4}, "true", false},
+		{token.Position{Line: 0, Character: 4}, "len", false},
+		{token.Position{Line: 0, Character: 4}, "1x", false},
+		{token.Position{Line: 0, Character: 4}, "a b", false},
+		// collides with a global in the same scope
+		{token.Position{Line: 0, Character: 4}, "z", false},
+		// the use of x inside the closure would resolve to the parameter b
+		{token.Position{Line: 0, Character: 4}, "b", false},
+		// the use of x inside the closure would resolve to the local y
+		{token.Position{Line: 0, Character: 4}, "y", false},
+		// the parameter would shadow the global x used inside the closure
+		{token.Position{Line: 1, Character: 30}, "x", false},
+		// the local would shadow the global x used inside the closure
+		{token.Position{Line: 1, Character: 20}, "x", false},
+		// w doesn't shadow anything used in its scope
+		{token.Position{Line: 2, Character: 19}, "x", true},
+		// collides with the parameter in the same scope
+		{token.Position{Line: 1, Character: 20}, "a", false},
+		{token.Position{Line: 1, Character: 20}, "w", true},
+		{token.Position{Line: 1, Character: 39}, "len", false},
+	}
+
+	program := parse(input)
+	compiler := New(MockLogger)
+	if err := compiler.Compile(program); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		ident := ast.IdentifierAt(program, tt.position)
+		symbol, ok := compiler.ResolveIdentifier(ident)
+		if !ok {
+			t.Fatalf("Identifier at %v wasn't resolved", tt.position)
+		}
+
+		err := compiler.ValidateRename(symbol, tt.newName)
+		if (err == nil) != tt.valid {
+			t.Fatalf("Wrong rename validation of %s to %s, want=%t; got=%v",
+				symbol.Name, tt.newName, tt.valid, err)
+		}
+	}
+}
+
+func TestBytecode(t *testing.T) {
+	tests := []struct {
+		input                string
+		expectedConstants    []interface{}
+		expectedInstructions []code.Instructions
+	}{
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = "x"; [a, len(a)]`,
+			expectedConstants: []interface{}{"x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn() { f() };",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c, err := runCompiler(compilerTestCase{input: tt.input})
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %s", tt.input, err)
+		}
+
+		bytecode := c.Bytecode()
+
+		expected := concatInstructions(tt.expectedInstructions)
+		if bytecode.Instructions.String() != expected.String() {
+			t.Fatalf("Wrong instructions of %q, want=\n%s; got=\n%s", tt.input, expected, bytecode.Instructions)
+		}
+
+		if len(bytecode.Constants) != len(tt.expectedConstants) {
+			t.Fatalf("Wrong number of constants of %q, want=%d; got=%d", tt.input, len(tt.expectedConstants), len(bytecode.Constants))
+		}
+
+		for i, constant := range tt.expectedConstants {
+			testConstant(t, tt.input, constant, bytecode.Constants[i])
+		}
+	}
+}
+
+func testConstant(t *testing.T, input string, expected interface{}, actual object.Object) {
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Fatalf("Wrong constant of %q, want=%d; got=%s", input, expected, actual.Inspect())
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Fatalf("Wrong constant of %q, want=%q; got=%s", input, expected, actual.Inspect())
+		}
+	case []code.Instructions:
+		fn, ok := actual.(*object.CompiledFunction)
+		if !ok {
+			t.Fatalf("Wrong constant of %q, want=CompiledFunction; got=%s", input, actual.Type())
+		}
+
+		instructions := concatInstructions(expected)
+		if fn.Instructions.String() != instructions.String() {
+			t.Fatalf("Wrong function instructions of %q, want=\n%s; got=\n%s", input, instructions, fn.Instructions)
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
 func createCompletionItem(
 	label, detail, documentation string,
 	kind int,
@@ -170,3 +519,10 @@ func parse(input string) *ast.Program {
 	p := parser.New(l)
 	return p.ParseProgram()
 }
+
+func createRange(line, character, length int) token.Range {
+	return token.Range{
+		Start: token.Position{Line: line, Character: character},
+		End:   token.Position{Line: line, Character: character + length},
+	}
+}
@@ -0,0 +1,31 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+type ErrorCode string
+
+const (
+	UndefinedVariable ErrorCode = "undefined-variable"
+)
+
+type CompilerError struct {
+	Message string
+	Range   token.Range
+	Code    ErrorCode
+}
+
+func (ce CompilerError) Error() string {
+	return fmt.Sprintf("%s %s", ce.Range, ce.Message)
+}
+
+func (c *Compiler) addError(code ErrorCode, rng token.Range, format string, a ...any) {
+	c.errors = append(c.errors, CompilerError{
+		Message: fmt.Sprintf(format, a...),
+		Range:   rng,
+		Code:    code,
+	})
+}
@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// Reference is a single occurrence of a symbol in the program.
+type Reference struct {
+	Identifier *ast.Identifier
+	Symbol     Symbol
+
+	// IsDefinition is true for let names and parameters, which write the
+	// symbol, and false for reads
+	IsDefinition bool
+
+	// table is the scope the identifier appears in
+	table *SymbolTable
+}
+
+// binding identifies a definition independently of the scope it's seen from,
+// so local, free and function name symbols of one definition share it.
+// Builtins have no definition range and are told apart by name.
+type binding struct {
+	name       string
+	definition token.Range
+}
+
+func bindingOf(symbol Symbol) binding {
+	return binding{name: symbol.Name, definition: symbol.Range}
+}
+
+func (c *Compiler) recordReference(ident *ast.Identifier, symbol Symbol, isDefinition bool) {
+	c.resolved[ident] = symbol
+
+	key := bindingOf(symbol)
+	c.references[key] = append(c.references[key], Reference{
+		Identifier:   ident,
+		Symbol:       symbol,
+		IsDefinition: isDefinition,
+		table:        c.symbolTable,
+	})
+}
+
+// References returns all occurrences of the definition the symbol refers to,
+// ordered by their position in the source.
+func (c *Compiler) References(symbol Symbol) []Reference {
+	references := append([]Reference{}, c.references[bindingOf(symbol)]...)
+
+	sort.Slice(references, func(i, j int) bool {
+		return references[i].Identifier.Range().Start.Before(references[j].Identifier.Range().Start)
+	})
+
+	return references
+}
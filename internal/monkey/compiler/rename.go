@@ -0,0 +1,105 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// ValidateRename checks that every reference of the symbol can be renamed to
+// newName without changing what any identifier in the program resolves to.
+// The check is conservative, definitions that come later in a scope are
+// considered visible in the whole scope.
+func (c *Compiler) ValidateRename(symbol Symbol, newName string) error {
+	if symbol.Scope == BuiltinScope {
+		return fmt.Errorf("builtin function %s can't be renamed", symbol.Name)
+	}
+
+	if !isIdentifier(newName) {
+		return fmt.Errorf("%q is not a valid identifier", newName)
+	}
+
+	if token.LookupIdent(newName) != token.IDENT {
+		return fmt.Errorf("%s is a keyword", newName)
+	}
+
+	if slices.Contains(object.Builtins, newName) {
+		return fmt.Errorf("%s is a builtin function", newName)
+	}
+
+	if newName == symbol.Name {
+		return nil
+	}
+
+	references := c.References(symbol)
+	definition, ok := definitionTable(references)
+	if !ok {
+		return fmt.Errorf("definition of %s not found", symbol.Name)
+	}
+
+	if _, ok := definition.store[newName]; ok {
+		return fmt.Errorf("%s is already defined in this scope", newName)
+	}
+
+	// A use of the symbol would be captured by a closer definition of newName
+	for _, reference := range references {
+		for table := reference.table; table != nil && table != definition; table = table.Outer {
+			if _, ok := table.store[newName]; ok {
+				return fmt.Errorf(
+					"renaming would make %s at %s refer to another definition",
+					symbol.Name,
+					reference.Identifier.Range(),
+				)
+			}
+		}
+	}
+
+	// The renamed symbol would shadow another definition of newName
+	for key, others := range c.references {
+		if key.name != newName {
+			continue
+		}
+
+		otherDefinition, ok := definitionTable(others)
+		if !ok {
+			continue
+		}
+
+		for _, reference := range others {
+			for table := reference.table; table != nil && table != otherDefinition; table = table.Outer {
+				if table == definition {
+					return fmt.Errorf(
+						"renaming would shadow %s used at %s",
+						newName,
+						reference.Identifier.Range(),
+					)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func definitionTable(references []Reference) (*SymbolTable, bool) {
+	for _, reference := range references {
+		if reference.IsDefinition {
+			return reference.table, true
+		}
+	}
+	return nil, false
+}
+
+func isIdentifier(name string) bool {
+	l := lexer.New(name)
+
+	tok := l.NextToken()
+	if tok.Type == token.ILLEGAL || tok.Type == token.EOF || tok.Literal != name {
+		return false
+	}
+
+	return l.NextToken().Type == token.EOF
+}
@@ -16,6 +16,10 @@ type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+
+	// Range of the identifier that defines the symbol. Free symbols keep the
+	// range of the captured definition, builtins don't have any.
+	Range token.Range
 }
 
 type SymbolTable struct {
@@ -43,8 +47,8 @@ func NewEnclosedSymbolTable(outer *SymbolTable, tableRange token.Range) *SymbolT
 	return s
 }
 
-func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions}
+func (s *SymbolTable) Define(name string, definition token.Range) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Range: definition}
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
 	} else {
@@ -105,8 +109,8 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	return symbol
 }
 
-func (s *SymbolTable) DefineFunctionName(name string) Symbol {
-	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+func (s *SymbolTable) DefineFunctionName(name string, definition token.Range) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0, Range: definition}
 	s.store[name] = symbol
 	return symbol
 }
@@ -114,9 +118,23 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
 
-	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Range: original.Range}
 	symbol.Scope = FreeScope
 
 	s.store[original.Name] = symbol
 	return symbol
 }
+
+// Clone copies the table, so symbols can be defined without affecting the
+// original. Outer tables are shared.
+func (s *SymbolTable) Clone() *SymbolTable {
+	clone := *s
+
+	clone.store = make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		clone.store[name] = symbol
+	}
+	clone.FreeSymbols = append([]Symbol{}, s.FreeSymbols...)
+
+	return &clone
+}
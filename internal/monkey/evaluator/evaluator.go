@@ -0,0 +1,496 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// Evaluator runs the syntax tree directly. Output of puts goes to out.
+type Evaluator struct {
+	out io.Writer
+
+	ctx       context.Context
+	limits    Limits
+	steps     int
+	depth     int
+	allocated int
+}
+
+// Limits bound the work of a sandboxed evaluation, zero means unlimited.
+// Every evaluated node is a step, depth counts nested function calls.
+// MaxAllocation is the total number of bytes of the strings, arrays and
+// hashes the program may create, memory freed meanwhile isn't returned.
+type Limits struct {
+	MaxSteps      int
+	MaxDepth      int
+	MaxAllocation int
+}
+
+// Sizes counted against MaxAllocation for an array element, which is an
+// interface value, and for a hash pair, which also holds the hash key.
+const (
+	elementSize = 16
+	pairSize    = 56
+)
+
+// contextCheckInterval is the number of steps between checks of the context.
+const contextCheckInterval = 1024
+
+func New(out io.Writer) *Evaluator {
+	return &Evaluator{out: out, ctx: context.Background()}
+}
+
+// NewSandboxed stops the evaluation with an error when a limit is exceeded or
+// the context is done, so programs that never finish can be run safely.
+func NewSandboxed(ctx context.Context, out io.Writer, limits Limits) *Evaluator {
+	return &Evaluator{out: out, ctx: ctx, limits: limits}
+}
+
+// Eval evaluates the node in the environment. Runtime errors are returned as
+// *object.Error carrying the range of the node that failed.
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(node); err != nil {
+		return err
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return e.evalProgram(node, env)
+
+	case *ast.ExpressionStatement:
+		return e.Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := e.Eval(node.ReturnValue, env)
+		if object.IsError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.LetStatement:
+		val := e.Eval(node.Value, env)
+		if object.IsError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.Boolean:
+		return object.NativeBoolToBooleanObject(node.Value)
+
+	case *ast.PrefixExpression:
+		right := e.Eval(node.Right, env)
+		if object.IsError(right) {
+			return right
+		}
+		return evalPrefixExpression(node, right)
+
+	case *ast.InfixExpression:
+		left := e.Eval(node.Left, env)
+		if object.IsError(left) {
+			return left
+		}
+
+		right := e.Eval(node.Right, env)
+		if object.IsError(right) {
+			return right
+		}
+
+		// Concatenation is checked before the string is built, so doubling a
+		// string can't run out of memory
+		if l, ok := left.(*object.String); ok && node.Operator == "+" {
+			if r, ok := right.(*object.String); ok {
+				if err := e.allocate(node, len(l.Value)+len(r.Value)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return evalInfixExpression(node, left, right)
+
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env)
+
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+
+	case *ast.CallExpression:
+		function := e.Eval(node.Function, env)
+		if object.IsError(function) {
+			return function
+		}
+
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && object.IsError(args[0]) {
+			return args[0]
+		}
+
+		return e.applyFunction(node, function, args)
+
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && object.IsError(elements[0]) {
+			return elements[0]
+		}
+		if err := e.allocate(node, len(elements)*elementSize); err != nil {
+			return err
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.IndexExpression:
+		left := e.Eval(node.Left, env)
+		if object.IsError(left) {
+			return left
+		}
+
+		index := e.Eval(node.Index, env)
+		if object.IsError(index) {
+			return index
+		}
+
+		return evalIndexExpression(node, left, index)
+
+	case *ast.HashLiteral:
+		return e.evalHashLiteral(node, env)
+
+	case *ast.BadExpression, *ast.BadStatement:
+		return newError(node, "invalid syntax")
+	}
+
+	return nil
+}
+
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = e.Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement stops at a return statement but keeps the return value
+// wrapped, so the enclosing blocks stop too. Blocks that don't end with an
+// expression are null.
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = e.Eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	if result == nil {
+		return object.NULL
+	}
+	return result
+}
+
+func (e *Evaluator) evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(node.Condition, env)
+	if object.IsError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return e.Eval(node.Consequence, env)
+	} else if node.Alternative != nil {
+		return e.Eval(node.Alternative, env)
+	}
+
+	return object.NULL
+}
+
+// evalExpressions stops at the first error and returns only that.
+func (e *Evaluator) evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+	result := []object.Object{}
+
+	for _, expression := range expressions {
+		evaluated := e.Eval(expression, env)
+		if object.IsError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func (e *Evaluator) applyFunction(node *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError(node, "wrong number of arguments. got=%d, want=%d", len(args), len(fn.Parameters))
+		}
+
+		e.depth++
+		defer func() { e.depth-- }()
+
+		if e.limits.MaxDepth > 0 && e.depth > e.limits.MaxDepth {
+			return newError(node, "stack overflow")
+		}
+
+		env := object.NewEnclosedEnvironment(fn.Env)
+		for i, param := range fn.Parameters {
+			env.Set(param.Value, args[i])
+		}
+
+		evaluated := e.Eval(fn.Body, env)
+		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+			return returnValue.Value
+		}
+		return evaluated
+
+	case *object.Builtin:
+		result := fn.Fn(e.out, args...)
+		if err, ok := result.(*object.Error); ok && err.Range == (token.Range{}) {
+			err.Range = errorRange(node)
+		}
+
+		// Arrays returned by builtins are new, except for the elements first
+		// and last return, which are counted once more
+		if array, ok := result.(*object.Array); ok {
+			if err := e.allocate(node, len(array.Elements)*elementSize); err != nil {
+				return err
+			}
+		}
+		return result
+	}
+
+	return newError(node, "not a function: %s", fn.Type())
+}
+
+// step counts the node against the limits. Nodes are only counted when they
+// exist, so there's always a range to report.
+func (e *Evaluator) step(node ast.Node) *object.Error {
+	if node == nil {
+		return nil
+	}
+
+	e.steps++
+
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return newError(node, "step limit of %d exceeded", e.limits.MaxSteps)
+	}
+
+	if e.steps%contextCheckInterval == 0 {
+		switch err := e.ctx.Err(); {
+		case errors.Is(err, context.DeadlineExceeded):
+			return newError(node, "time limit exceeded")
+		case err != nil:
+			return newError(node, "evaluation cancelled")
+		}
+	}
+
+	return nil
+}
+
+// allocate counts the size against the allocation limit.
+func (e *Evaluator) allocate(node ast.Node, size int) *object.Error {
+	e.allocated += size
+
+	if e.limits.MaxAllocation > 0 && e.allocated > e.limits.MaxAllocation {
+		return newError(node, "allocation limit of %d bytes exceeded", e.limits.MaxAllocation)
+	}
+	return nil
+}
+
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := map[object.HashKey]object.HashPair{}
+
+	for _, keyNode := range node.SortedKeys() {
+		key := e.Eval(keyNode, env)
+		if object.IsError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError(keyNode, "unusable as hash key: %s", key.Type())
+		}
+
+		value := e.Eval(node.Pairs[keyNode], env)
+		if object.IsError(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	if err := e.allocate(node, len(pairs)*pairSize); err != nil {
+		return err
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := object.GetBuiltinByName(node.Value); ok {
+		return builtin
+	}
+
+	return newError(node, "identifier not found: %s", node.Value)
+}
+
+func evalPrefixExpression(node *ast.PrefixExpression, right object.Object) object.Object {
+	switch node.Operator {
+	case "!":
+		return object.NativeBoolToBooleanObject(!isTruthy(right))
+
+	case "-":
+		if integer, ok := right.(*object.Integer); ok {
+			return &object.Integer{Value: -integer.Value}
+		}
+		return newError(node, "unknown operator: -%s", right.Type())
+	}
+
+	return newError(node, "unknown operator: %s%s", node.Operator, right.Type())
+}
+
+// evalInfixExpression follows the type checker, strings can be compared for
+// equality and values of different types are never equal.
+func evalInfixExpression(node *ast.InfixExpression, left, right object.Object) object.Object {
+	operator := node.Operator
+
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(node, left.(*object.Integer).Value, right.(*object.Integer).Value)
+
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(node, left.(*object.String).Value, right.(*object.String).Value)
+
+	case operator == "==":
+		return object.NativeBoolToBooleanObject(left == right)
+
+	case operator == "!=":
+		return object.NativeBoolToBooleanObject(left != right)
+
+	case left.Type() != right.Type():
+		return newError(node, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return newError(node, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func evalIntegerInfixExpression(node *ast.InfixExpression, left, right int64) object.Object {
+	switch node.Operator {
+	case "+":
+		return &object.Integer{Value: left + right}
+	case "-":
+		return &object.Integer{Value: left - right}
+	case "*":
+		return &object.Integer{Value: left * right}
+	case "/":
+		if right == 0 {
+			return newError(node, "division by zero")
+		}
+		return &object.Integer{Value: left / right}
+	case "<":
+		return object.NativeBoolToBooleanObject(left < right)
+	case ">":
+		return object.NativeBoolToBooleanObject(left > right)
+	case "==":
+		return object.NativeBoolToBooleanObject(left == right)
+	case "!=":
+		return object.NativeBoolToBooleanObject(left != right)
+	}
+
+	return newError(node, "unknown operator: INTEGER %s INTEGER", node.Operator)
+}
+
+func evalStringInfixExpression(node *ast.InfixExpression, left, right string) object.Object {
+	switch node.Operator {
+	case "+":
+		return &object.String{Value: left + right}
+	case "==":
+		return object.NativeBoolToBooleanObject(left == right)
+	case "!=":
+		return object.NativeBoolToBooleanObject(left != right)
+	}
+
+	return newError(node, "unknown operator: STRING %s STRING", node.Operator)
+}
+
+func evalIndexExpression(node *ast.IndexExpression, left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return object.NULL
+		}
+		return elements[i]
+
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError(node.Index, "unusable as hash key: %s", index.Type())
+		}
+
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return object.NULL
+		}
+		return pair.Value
+	}
+
+	return newError(node, "index operator not supported: %s", left.Type())
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case object.NULL, object.FALSE:
+		return false
+	}
+	return true
+}
+
+func newError(node ast.Node, format string, a ...any) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Range: errorRange(node)}
+}
+
+// errorRange extends calls and index expressions over their left side, their
+// own range starts at the bracket.
+func errorRange(node ast.Node) token.Range {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		return token.Range{Start: node.Function.Range().Start, End: node.Range().End}
+	case *ast.IndexExpression:
+		return token.Range{Start: node.Left.Range().Start, End: node.Range().End}
+	}
+	return node.Range()
+}
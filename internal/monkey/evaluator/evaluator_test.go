@@ -0,0 +1,214 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+func TestEvalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5", 5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * (5 + 10)", 30},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"!true", false},
+		{"!!5", true},
+		{"1 < 2", true},
+		{"1 == 2", false},
+		{"(1 < 2) == true", true},
+		{"1 == true", false},
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"a" == 1`, false},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (true) { let a = 1; }", nil},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(2);", 4},
+		{"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)", 610},
+		{"[1, 2 * 2, 3 + 3][1]", 4},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+		{`len("four")`, 4},
+		{"len([1, 2, 3])", 3},
+		{"first([1, 2, 3])", 1},
+		{"last([1, 2, 3])", 3},
+		{"first([])", nil},
+		{"len(rest([1, 2, 3]))", 2},
+		{"let a = [1]; let b = push(a, 2); len(a) + len(b)", 3},
+		{`{"one": 1, "two": 2}["two"]`, 2},
+		{`{"one": 1}["two"]`, nil},
+		{"{true: 5}[true]", 5},
+		{"{5: 5}[5]", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, tt.input, evaluated, int64(expected))
+		case bool:
+			if evaluated != object.NativeBoolToBooleanObject(expected) {
+				t.Fatalf("Wrong result of %q, want=%t; got=%s", tt.input, expected, inspect(evaluated))
+			}
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Fatalf("Wrong result of %q, want=%q; got=%s", tt.input, expected, inspect(evaluated))
+			}
+		case nil:
+			if evaluated != object.NULL {
+				t.Fatalf("Wrong result of %q, want=null; got=%s", tt.input, inspect(evaluated))
+			}
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedRange   token.Range
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN", singleLineRange(0, 0, 8)},
+		{"-true", "unknown operator: -BOOLEAN", singleLineRange(0, 0, 5)},
+		{`"a" - "b"`, "unknown operator: STRING - STRING", singleLineRange(0, 0, 9)},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN", singleLineRange(0, 0, 12)},
+		{"if (10 > 1) { return true + false; }", "unknown operator: BOOLEAN + BOOLEAN", singleLineRange(0, 21, 33)},
+		{"foobar", "identifier not found: foobar", singleLineRange(0, 0, 6)},
+		{"1 / 0", "division by zero", singleLineRange(0, 0, 5)},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION", singleLineRange(0, 19, 30)},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments. got=2, want=1", singleLineRange(0, 21, 28)},
+		{"len(1)", "argument to `len` not supported, got INTEGER", singleLineRange(0, 0, 6)},
+		{"1(2)", "not a function: INTEGER", singleLineRange(0, 0, 4)},
+		{"1[0]", "index operator not supported: INTEGER", singleLineRange(0, 0, 4)},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("No error for %q, got=%s", tt.input, inspect(evaluated))
+		}
+
+		if err.Message != tt.expectedMessage {
+			t.Fatalf("Wrong error message for %q, want=%q; got=%q", tt.input, tt.expectedMessage, err.Message)
+		}
+
+		if err.Range != tt.expectedRange {
+			t.Fatalf("Wrong error range for %q, want=%s; got=%s", tt.input, tt.expectedRange, err.Range)
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	var out bytes.Buffer
+
+	program := parser.New(lexer.New(`puts("a", 1, [true])`)).ParseProgram()
+	result := New(&out).Eval(program, object.NewEnvironment())
+
+	if result != object.NULL {
+		t.Fatalf("puts should return null, got=%s", inspect(result))
+	}
+
+	if out.String() != "a\n1\n[true]\n" {
+		t.Fatalf("Wrong output, want=%q; got=%q", "a\n1\n[true]\n", out.String())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input           string
+		ctx             context.Context
+		limits          Limits
+		expectedMessage string
+		expectedRange   token.Range
+	}{
+		{"1 + 2", context.Background(), Limits{MaxSteps: 5}, "", token.Range{}},
+		{"1 + 2", context.Background(), Limits{MaxSteps: 4}, "step limit of 4 exceeded", singleLineRange(0, 4, 5)},
+		{"let f = fn() { f() }; f()", context.Background(), Limits{MaxDepth: 100}, "stack overflow", singleLineRange(0, 15, 18)},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(50)", context.Background(), Limits{MaxDepth: 100}, "", token.Range{}},
+		{"let f = fn() { f() }; f()", cancelled, Limits{}, "evaluation cancelled", singleLineRange(0, 15, 18)},
+		{
+			`let f = fn(s, n) { if (n == 0) { len(s) } else { f(s + s, n - 1) } }; f("a", 40)`,
+			context.Background(),
+			Limits{MaxAllocation: 1 << 20},
+			"allocation limit of 1048576 bytes exceeded",
+			singleLineRange(0, 51, 56),
+		},
+		{`let s = "ab" + "cd"; [s, s]`, context.Background(), Limits{MaxAllocation: 36}, "", token.Range{}},
+		{`let s = "ab" + "cd"; [s, s]`, context.Background(), Limits{MaxAllocation: 35}, "allocation limit of 35 bytes exceeded", singleLineRange(0, 21, 27)},
+		{"push([1], 2)", context.Background(), Limits{MaxAllocation: 40}, "allocation limit of 40 bytes exceeded", singleLineRange(0, 0, 12)},
+		{`{"a": 1}`, context.Background(), Limits{MaxAllocation: 50}, "allocation limit of 50 bytes exceeded", singleLineRange(0, 0, 8)},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := NewSandboxed(tt.ctx, &bytes.Buffer{}, tt.limits).Eval(program, object.NewEnvironment())
+
+		err, ok := evaluated.(*object.Error)
+		if tt.expectedMessage == "" {
+			if ok {
+				t.Fatalf("Unexpected error for %q: %s", tt.input, err.Message)
+			}
+			continue
+		}
+
+		if !ok {
+			t.Fatalf("No error for %q, got=%s", tt.input, inspect(evaluated))
+		}
+
+		if err.Message != tt.expectedMessage {
+			t.Fatalf("Wrong error message for %q, want=%q; got=%q", tt.input, tt.expectedMessage, err.Message)
+		}
+
+		if err.Range != tt.expectedRange {
+			t.Fatalf("Wrong error range for %q, want=%s; got=%s", tt.input, tt.expectedRange, err.Range)
+		}
+	}
+}
+
+func testEval(input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return New(&bytes.Buffer{}).Eval(program, object.NewEnvironment())
+}
+
+func testIntegerObject(t *testing.T, input string, obj object.Object, expected int64) {
+	result, ok := obj.(*object.Integer)
+	if !ok || result.Value != expected {
+		t.Fatalf("Wrong result of %q, want=%d; got=%s", input, expected, inspect(obj))
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
+
+func singleLineRange(line, start, end int) token.Range {
+	return token.Range{
+		Start: token.Position{Line: line, Character: start},
+		End:   token.Position{Line: line, Character: end},
+	}
+}
@@ -0,0 +1,562 @@
+package formatter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// ErrSyntax is returned for sources that don't parse, they are never formatted
+// because the result could lose code.
+var ErrSyntax = errors.New("source has syntax errors")
+
+type Options struct {
+	IndentSize int
+	UseTabs    bool
+
+	// MaxWidth is the column at which arrays, hashes and argument lists are
+	// broken into one element per line
+	MaxWidth int
+}
+
+func DefaultOptions() Options {
+	return Options{IndentSize: 2, UseTabs: false, MaxWidth: 80}
+}
+
+var infixPrecedences = map[string]int{
+	"==": parser.EQUALS,
+	"!=": parser.EQUALS,
+	"<":  parser.LESSGREATER,
+	">":  parser.LESSGREATER,
+	"+":  parser.SUM,
+	"-":  parser.SUM,
+	"*":  parser.PRODUCT,
+	"/":  parser.PRODUCT,
+}
+
+// atom is the precedence of expressions that never need parentheses.
+const atom = parser.INDEX + 1
+
+// Source parses and formats a whole source.
+func Source(src string, options Options) (string, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", fmt.Errorf("%w: %s", ErrSyntax, p.Errors()[0])
+	}
+
+	return Program(program, options), nil
+}
+
+// Program formats the statements of a program and its comments. The result
+// ends with a newline unless the program is empty.
+func Program(program *ast.Program, options Options) string {
+	p := &printer{options: options}
+	p.statements(program.Statements, false)
+	p.dangling(program.Statements, program.Dangling)
+
+	result := p.sb.String()
+	if result == "" {
+		return ""
+	}
+	return result + "\n"
+}
+
+// Statements formats top level statements with the comments attached to them.
+// Single blank lines between them are kept, longer runs are collapsed.
+func Statements(statements []ast.Statement, options Options) string {
+	p := &printer{options: options}
+	p.statements(statements, false)
+	return p.sb.String()
+}
+
+type printer struct {
+	options Options
+	sb      strings.Builder
+	indent  int
+
+	// column is where the next write starts, nested printers start at the
+	// column of their parent so they know how much space is left
+	column int
+
+	// flat printers never break lines, they are used to measure expressions
+	flat bool
+
+	// pending are the inner comments of the statement being printed that
+	// weren't written yet, they are written before the node following them
+	pending []token.Comment
+}
+
+func (p *printer) write(s string) {
+	p.sb.WriteString(s)
+
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.column = len(s) - i - 1
+	} else {
+		p.column += len(s)
+	}
+}
+
+// blankLine starts a new line after an empty one. The empty line isn't
+// indented, so it doesn't end with whitespace.
+func (p *printer) blankLine() {
+	p.write("\n")
+	p.newline()
+}
+
+func (p *printer) newline() {
+	if p.options.UseTabs {
+		p.write("\n" + strings.Repeat("\t", p.indent))
+		// Tabs are counted as a single column, close enough for measuring
+		return
+	}
+	p.write("\n" + strings.Repeat(" ", p.indent*p.options.IndentSize))
+}
+
+// fits reports whether a rendering can be written on the current line.
+func (p *printer) fits(s string) bool {
+	if strings.Contains(s, "\n") {
+		return false
+	}
+	return p.flat || p.column+len(s) <= p.options.MaxWidth
+}
+
+// render prints with a nested printer starting at the current column. The
+// result is only measured until it's written with writeRendered.
+func (p *printer) render(flat bool, print func(*printer)) *printer {
+	nested := &printer{
+		options: p.options,
+		indent:  p.indent,
+		column:  p.column,
+		flat:    p.flat || flat,
+		pending: p.pending,
+	}
+	print(nested)
+	return nested
+}
+
+// writeRendered writes the result of render, comments it wrote are no longer
+// pending.
+func (p *printer) writeRendered(rendered *printer) {
+	p.write(rendered.sb.String())
+	p.pending = rendered.pending
+}
+
+// commentsBefore writes pending comments that start before the position. Line
+// comments end the line, so what follows them starts on a new one.
+func (p *printer) commentsBefore(position token.Position) {
+	for len(p.pending) > 0 && p.pending[0].Range.Start.Before(position) {
+		c := p.pending[0]
+		p.pending = p.pending[1:]
+
+		p.write(c.Text)
+		if c.IsBlock() {
+			p.write(" ")
+		} else {
+			p.newline()
+		}
+	}
+}
+
+// trailingCommentsOn writes pending comments that start on the line before the
+// next position, after what was written on it. Comments followed by the next
+// position on their line are left to it.
+func (p *printer) trailingCommentsOn(line int, next token.Position) {
+	for len(p.pending) > 0 {
+		c := p.pending[0]
+		if c.Range.Start.Line != line || !c.Range.Start.Before(next) || c.Range.End.Line == next.Line {
+			return
+		}
+
+		p.write(" " + c.Text)
+		p.pending = p.pending[1:]
+	}
+}
+
+// hasLineCommentBefore reports whether a pending line comment starts before
+// the position.
+func (p *printer) hasLineCommentBefore(position token.Position) bool {
+	for _, c := range p.pending {
+		if !c.Range.Start.Before(position) {
+			break
+		}
+		if !c.IsBlock() {
+			return true
+		}
+	}
+	return false
+}
+
+// statements prints statements on separate lines. In blocks the last expression
+// statement is the value of the block and isn't terminated.
+func (p *printer) statements(statements []ast.Statement, inBlock bool) {
+	for i, s := range statements {
+		if i > 0 {
+			p.separate(ast.FullRange(statements[i-1]).End.Line, ast.FullRange(s).Start.Line)
+		}
+
+		p.leadingComments(s)
+		p.statement(s, inBlock && i == len(statements)-1)
+		p.trailingComments(s)
+	}
+}
+
+// leadingComments prints comments above the statement, each on its own line.
+func (p *printer) leadingComments(s ast.Statement) {
+	trivia := ast.StatementTrivia(s)
+	if trivia == nil {
+		return
+	}
+
+	for i, c := range trivia.Leading {
+		next := s.Range().Start.Line
+		if i+1 < len(trivia.Leading) {
+			next = trivia.Leading[i+1].Range.Start.Line
+		}
+
+		p.write(c.Text)
+		p.separate(c.Range.End.Line, next)
+	}
+}
+
+func (p *printer) trailingComments(s ast.Statement) {
+	if trivia := ast.StatementTrivia(s); trivia != nil {
+		for _, c := range trivia.Trailing {
+			p.write(" " + c.Text)
+		}
+	}
+}
+
+// dangling prints comments that follow the statements, at the end of a block
+// or of the program.
+func (p *printer) dangling(statements []ast.Statement, comments []token.Comment) {
+	for i, c := range comments {
+		switch {
+		case i > 0:
+			p.separate(comments[i-1].Range.End.Line, c.Range.Start.Line)
+		case len(statements) > 0:
+			p.separate(ast.FullRange(statements[len(statements)-1]).End.Line, c.Range.Start.Line)
+		}
+
+		p.write(c.Text)
+	}
+}
+
+// separate starts a new line, keeping a blank line if there was one between
+// the lines in the source.
+func (p *printer) separate(previousLine, nextLine int) {
+	if nextLine > previousLine+1 {
+		p.blankLine()
+	} else {
+		p.newline()
+	}
+}
+
+// statement prints the statement with its inner comments where they were,
+// the ones after its last expression are kept before the semicolon.
+func (p *printer) statement(s ast.Statement, isBlockValue bool) {
+	// Nested statements have their own inner comments
+	outer := p.pending
+	defer func() { p.pending = outer }()
+
+	p.pending = nil
+	if trivia := ast.StatementTrivia(s); trivia != nil {
+		p.pending = trivia.Inner
+	}
+
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write("let " + s.Name.Value + " = ")
+		p.expression(s.Value, parser.LOWEST)
+		p.remainingComments()
+		p.write(";")
+
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(s.ReturnValue, parser.LOWEST)
+		p.remainingComments()
+		p.write(";")
+
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+		p.remainingComments()
+		if _, isIf := s.Expression.(*ast.IfExpression); !isIf && !isBlockValue {
+			p.write(";")
+		}
+
+	default:
+		p.write(s.String())
+	}
+}
+
+// remainingComments writes the inner comments after the last expression of a
+// statement.
+func (p *printer) remainingComments() {
+	for _, c := range p.pending {
+		p.write(" " + c.Text)
+		if !c.IsBlock() {
+			p.newline()
+		}
+	}
+	p.pending = nil
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && len(b.Dangling) == 0 {
+		p.write("{}")
+		return
+	}
+
+	// Blocks holding a single expression stay on one line when they fit and
+	// have no comments
+	if s, ok := singleExpression(b); ok && !s.HasComments() && len(b.Dangling) == 0 {
+		inline := p.render(true, func(n *printer) {
+			n.write("{ ")
+			n.expression(s.Expression, parser.LOWEST)
+			n.write(" }")
+		})
+		if p.fits(inline.sb.String()) {
+			p.writeRendered(inline)
+			return
+		}
+	}
+
+	p.write("{")
+	p.indent++
+	p.newline()
+	p.statements(b.Statements, true)
+	p.dangling(b.Statements, b.Dangling)
+	p.indent--
+	p.newline()
+	p.write("}")
+}
+
+func singleExpression(b *ast.BlockStatement) (*ast.ExpressionStatement, bool) {
+	if len(b.Statements) != 1 {
+		return nil, false
+	}
+	s, ok := b.Statements[0].(*ast.ExpressionStatement)
+	return s, ok
+}
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return infixPrecedences[e.Operator]
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	}
+	return atom
+}
+
+// expression prints e, wrapped in parentheses when it binds weaker than the
+// context it appears in.
+func (p *printer) expression(e ast.Expression, context int) {
+	p.commentsBefore(ast.Span(e).Start)
+
+	if precedence(e) < context {
+		p.write("(")
+		p.expression(e, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+
+	case *ast.IntegerLiteral:
+		p.write(e.Token.Literal)
+
+	case *ast.StringLiteral:
+		p.write(`"` + e.Value + `"`)
+
+	case *ast.Boolean:
+		p.write(e.String())
+
+	case *ast.PrefixExpression:
+		// Prefix operators nest without parentheses, except "-(-a)", which
+		// would read as a decrement
+		p.write(e.Operator)
+		if right, ok := e.Right.(*ast.PrefixExpression); ok && e.Operator == "-" && right.Operator == "-" {
+			p.expression(e.Right, parser.PREFIX+1)
+		} else {
+			p.expression(e.Right, parser.PREFIX)
+		}
+
+	case *ast.InfixExpression:
+		// Operators are left associative, so the right operand needs
+		// parentheses already at the same precedence
+		precedence := infixPrecedences[e.Operator]
+		p.expression(e.Left, precedence)
+		p.write(" " + e.Operator + " ")
+		p.expression(e.Right, precedence+1)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		params := []listItem{}
+		for _, param := range e.Parameters {
+			params = append(params, listItem{param.Range(), func(n *printer) {
+				n.commentsBefore(param.Range().Start)
+				n.write(param.Value)
+			}})
+		}
+		// Parameters stay on one line, unless a line comment ends it
+		p.write("fn")
+		if end := e.Body.Range().Start; p.hasLineCommentBefore(end) {
+			p.list("(", ")", params, end)
+		} else {
+			p.writeRendered(p.flatList("(", ")", params, end))
+		}
+		p.write(" ")
+		p.block(e.Body)
+
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		p.list("(", ")", expressionItems(e.Arguments), e.Range().End)
+
+	case *ast.IndexExpression:
+		// Calls and index expressions chain from left to right
+		p.expression(e.Left, parser.CALL)
+		p.write("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.write("]")
+
+	case *ast.ArrayLiteral:
+		p.list("[", "]", expressionItems(e.Elements), e.Range().End)
+
+	case *ast.HashLiteral:
+		items := []listItem{}
+		for _, key := range e.SortedKeys() {
+			value := e.Pairs[key]
+			span := token.Range{Start: ast.Span(key).Start, End: ast.Span(value).End}
+			items = append(items, listItem{span, func(n *printer) {
+				n.expression(key, parser.LOWEST)
+				n.write(": ")
+				n.expression(value, parser.LOWEST)
+			}})
+		}
+		p.list("{", "}", items, e.Range().End)
+
+	default:
+		p.write(e.String())
+	}
+}
+
+// listItem prints an element of a list, span is where it's in the source.
+type listItem struct {
+	span  token.Range
+	print func(*printer)
+}
+
+func expressionItems(expressions []ast.Expression) []listItem {
+	items := []listItem{}
+	for _, e := range expressions {
+		items = append(items, listItem{ast.Span(e), func(n *printer) {
+			n.expression(e, parser.LOWEST)
+		}})
+	}
+	return items
+}
+
+// list prints comma separated items on one line if they fit. Otherwise a list
+// whose last item is a function is kept open around it, and any other list
+// gets one item per line. Line comments in the list, which ends before end,
+// always get one item per line, so they can stay after their items.
+func (p *printer) list(open, close string, items []listItem, end token.Position) {
+	if !p.hasLineCommentBefore(end) {
+		flat := p.flatList(open, close, items, end)
+		if p.fits(flat.sb.String()) {
+			p.writeRendered(flat)
+			return
+		}
+
+		if len(items) > 0 {
+			last := len(items) - 1
+			hugged := p.render(false, func(n *printer) {
+				n.writeRendered(n.render(true, func(n *printer) {
+					n.write(open)
+					for _, item := range items[:last] {
+						item.print(n)
+						n.write(", ")
+					}
+				}))
+				items[last].print(n)
+				n.trailingCommentsBefore(end)
+				n.write(close)
+			})
+
+			firstLine, _, _ := strings.Cut(hugged.sb.String(), "\n")
+			if strings.HasSuffix(firstLine, "{") && p.fits(firstLine) {
+				p.writeRendered(hugged)
+				return
+			}
+		}
+	}
+
+	p.write(open)
+	p.indent++
+	for i, item := range items {
+		p.newline()
+		item.print(p)
+
+		next := end
+		if i < len(items)-1 {
+			p.write(",")
+			next = items[i+1].span.Start
+		}
+		p.trailingCommentsOn(item.span.End.Line, next)
+	}
+
+	// Comments on their own lines after the last item
+	for len(p.pending) > 0 && p.pending[0].Range.Start.Before(end) {
+		p.newline()
+		p.write(p.pending[0].Text)
+		p.pending = p.pending[1:]
+	}
+
+	p.indent--
+	p.newline()
+	p.write(close)
+}
+
+func (p *printer) flatList(open, close string, items []listItem, end token.Position) *printer {
+	return p.render(true, func(n *printer) {
+		n.write(open)
+		for i, item := range items {
+			if i > 0 {
+				n.write(", ")
+			}
+			item.print(n)
+		}
+		n.trailingCommentsBefore(end)
+		n.write(close)
+	})
+}
+
+// trailingCommentsBefore writes the block comments after the last item of a
+// list written on one line.
+func (p *printer) trailingCommentsBefore(end token.Position) {
+	for len(p.pending) > 0 && p.pending[0].Range.Start.Before(end) {
+		p.write(" " + p.pending[0].Text)
+		p.pending = p.pending[1:]
+	}
+}
@@ -0,0 +1,214 @@
+package formatter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"let x = (1 + 2) * 3;", "let x = (1 + 2) * 3;\n"},
+		{"let x = 1 - (2 - 3);", "let x = 1 - (2 - 3);\n"},
+		{"let x = (1 - 2) - 3;", "let x = 1 - 2 - 3;\n"},
+		{"-(-a); !(a == b)", "-(-a);\n!(a == b);\n"},
+		{"-!true; !(-x); !(!x); -(-!x)", "-!true;\n!-x;\n!!x;\n-(-!x);\n"},
+		{"f(1)[0]; (a + b)(1); a[0](1)", "f(1)[0];\n(a + b)(1);\na[0](1);\n"},
+		{"return  x", "return x;\n"},
+		{`let s = "a b"`, "let s = \"a b\";\n"},
+		{"let f = fn(a,b){a+b}", "let f = fn(a, b) { a + b };\n"},
+		{"let f = fn(){}", "let f = fn() {};\n"},
+		{
+			"let f = fn(a) { let b = a; b }",
+			"let f = fn(a) {\n  let b = a;\n  b\n};\n",
+		},
+		{
+			"if (a) { 1 } else { let b = 2; b }",
+			"if (a) { 1 } else {\n  let b = 2;\n  b\n}\n",
+		},
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{`{"b": 1, "a": [1,2]}`, "{\"b\": 1, \"a\": [1, 2]};\n"},
+		{
+			"let a = [\"aaaaaaaaaaaaaaaaaaaa\", \"bbbbbbbbbbbbbbbbbbbb\", \"cccccccccccccccccccc\", \"dddd\"];",
+			"let a = [\n  \"aaaaaaaaaaaaaaaaaaaa\",\n  \"bbbbbbbbbbbbbbbbbbbb\",\n  \"cccccccccccccccccccc\",\n  \"dddd\"\n];\n",
+		},
+		{
+			"map(arr, fn(x) { let y = x * 2; y })",
+			"map(arr, fn(x) {\n  let y = x * 2;\n  y\n});\n",
+		},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := Source(tt.input, DefaultOptions())
+		if err != nil {
+			t.Fatalf("Formatting %q failed: %s", tt.input, err)
+		}
+
+		if got != tt.expected {
+			t.Fatalf("Wrong formatting of %q, want=%q; got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	options := Options{IndentSize: 4, UseTabs: true, MaxWidth: 10}
+
+	got, err := Source("let f = fn(a) { let b = [1, 2, 3]; b }", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "let f = fn(a) {\n\tlet b = [\n\t\t1,\n\t\t2,\n\t\t3\n\t];\n\tb\n};\n"
+	if got != expected {
+		t.Fatalf("Wrong formatting, want=%q; got=%q", expected, got)
+	}
+}
+
+func TestFormattingKeepsMeaning(t *testing.T) {
+	inputs := []string{
+		`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10);`,
+		// String of a hash with more pairs isn't stable, their order is random
+		`let h = {"a": fn(x) { [1, 2, [3, 4]] }}; h["a"](1)[2][0] * -(2 + 3) - {true: {"n": -1}}[true]`,
+		`let a = if (x > 1) { "y" } else { "z" }; puts(a, len(a), first([a]), !true == false)`,
+		`let long = fn(aaaaaaaaaa, bbbbbbbbbb) { push([aaaaaaaaaa, bbbbbbbbbb, aaaaaaaaaa], bbbbbbbbbb * aaaaaaaaaa) };`,
+	}
+
+	for _, input := range inputs {
+		formatted, err := Source(input, DefaultOptions())
+		if err != nil {
+			t.Fatalf("Formatting %q failed: %s", input, err)
+		}
+
+		if parse(t, formatted) != parse(t, input) {
+			t.Fatalf("Formatting changed the program, want=%s; got=%s", parse(t, input), parse(t, formatted))
+		}
+
+		again, err := Source(formatted, DefaultOptions())
+		if err != nil || again != formatted {
+			t.Fatalf("Formatting isn't idempotent, want=%q; got=%q", formatted, again)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `# header
+
+// adds numbers
+let add = fn(a,b) { // opening
+    a+b // sum
+
+
+    // left over
+};   // after add
+let arr = [1, // one
+  2];
+let e = fn() {
+// only a comment
+};
+/* final */`
+
+	expected := `# header
+
+// adds numbers
+let add = fn(a, b) {
+  // opening
+  a + b // sum
+
+  // left over
+}; // after add
+let arr = [
+  1, // one
+  2
+];
+let e = fn() {
+  // only a comment
+};
+/* final */
+`
+
+	got, err := Source(input, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != expected {
+		t.Fatalf("Wrong formatting, want=%q; got=%q", expected, got)
+	}
+
+	again, err := Source(got, DefaultOptions())
+	if err != nil || again != got {
+		t.Fatalf("Formatting isn't idempotent, want=%q; got=%q", got, again)
+	}
+}
+
+func TestInnerComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = [1, /* inner */ 2, // eol\n 3];",
+			"let x = [\n  1,\n  /* inner */ 2, // eol\n  3\n];\n",
+		},
+		{"let z = [1, 2 /* end */];", "let z = [1, 2 /* end */];\n"},
+		{"let f = fn(a /* p */, b) { a };", "let f = fn(a, /* p */ b) { a };\n"},
+		{
+			"let f = fn(a, // first\n b) { a };",
+			"let f = fn(\n  a, // first\n  b\n) { a };\n",
+		},
+		{"f(1, /* two */ 2);", "f(1, /* two */ 2);\n"},
+		{
+			"f(1, // one\n 2 // two\n);",
+			"f(\n  1, // one\n  2 // two\n);\n",
+		},
+		{
+			"let h = {\"a\": 1, // a\n \"b\": 2};",
+			"let h = {\n  \"a\": 1, // a\n  \"b\": 2\n};\n",
+		},
+		{"let y = 1 + /* c */ 2;", "let y = 1 + /* c */ 2;\n"},
+		{
+			"let f = fn(x) { let y = [x, /* in */ x]; y };",
+			"let f = fn(x) {\n  let y = [x, /* in */ x];\n  y\n};\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source(tt.input, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tt.expected {
+			t.Fatalf("Wrong formatting of %q, want=%q; got=%q", tt.input, tt.expected, got)
+		}
+
+		if again, err := Source(got, DefaultOptions()); err != nil || again != got {
+			t.Fatalf("Formatting of %q isn't idempotent, want=%q; got=%q", tt.input, got, again)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	// An unterminated comment would swallow the final newline on every run
+	for _, input := range []string{"let = 1;", "let x = 1;\n/* open\n"} {
+		if _, err := Source(input, DefaultOptions()); !errors.Is(err, ErrSyntax) {
+			t.Fatalf("Wrong error for %q, want=%s; got=%v", input, ErrSyntax, err)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors in %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
@@ -17,10 +17,23 @@ func New(input string) *Lexer {
 	return l
 }
 
+// NextToken returns the next token with the comments around it attached as
+// trivia. Comments that follow the token on the same line are trailing trivia
+// of that token, every other comment is leading trivia of the token after it.
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	leading := l.readLeadingTrivia()
+
+	tok := l.readToken()
+	tok.Leading = leading
+	if tok.Type != token.EOF {
+		tok.Trailing = l.readTrailingTrivia()
+	}
+
+	return tok
+}
 
-	l.skipWhitespace()
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	// Line position increases with readPosition, so it needs to be decremented
 	// (because it's pointing at peek)
@@ -89,8 +102,11 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = literal
 		tok.Range = createSingleLineRange(startPosition.Character, startPosition.Line, length)
 	case 0:
+		// EOF doesn't consume anything, so repeated calls keep pointing at the end of input
 		tok.Literal = ""
 		tok.Type = token.EOF
+		tok.Range = createSingleLineRange(startPosition.Character, startPosition.Line, 0)
+		return tok
 	default:
 		if isLetter(l.ch) {
 			literal, length := l.readIndetifier()
@@ -159,6 +175,77 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+func (l *Lexer) readLeadingTrivia() []token.Comment {
+	var comments []token.Comment
+
+	for {
+		l.skipWhitespace()
+		if !l.isCommentStart() {
+			return comments
+		}
+		comments = append(comments, l.readComment())
+	}
+}
+
+func (l *Lexer) readTrailingTrivia() []token.Comment {
+	var comments []token.Comment
+	line := l.line
+
+	for l.line == line {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+			l.readChar()
+		}
+
+		if !l.isCommentStart() {
+			break
+		}
+		comments = append(comments, l.readComment())
+	}
+
+	return comments
+}
+
+func (l *Lexer) isCommentStart() bool {
+	return l.ch == '#' || l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// readComment reads a comment up to the end of the line, or up to the closing
+// "*/" for block comments. Unterminated block comments run to the end of input,
+// the parser reports them.
+func (l *Lexer) readComment() token.Comment {
+	start := token.Position{Character: l.linePosition - 1, Line: l.line}
+	position := l.position
+
+	if l.ch == '/' && l.peekChar() == '*' {
+		l.readChar()
+		l.readChar()
+
+		for l.ch != 0 && !(l.ch == '*' && l.peekChar() == '/') {
+			if l.ch == '\n' {
+				l.advanceLine()
+			}
+			l.readChar()
+		}
+
+		if l.ch != 0 {
+			l.readChar()
+			l.readChar()
+		}
+	} else {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
+
+	return token.Comment{
+		Text: l.input[position:l.position],
+		Range: token.Range{
+			Start: start,
+			End:   token.Position{Character: l.linePosition - 1, Line: l.line},
+		},
+	}
+}
+
 func (l *Lexer) advanceLine() {
 	l.line += 1
 	l.linePosition = 0
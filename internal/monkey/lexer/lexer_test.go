@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/marcsek/monkey-language-server/internal/monkey/token"
@@ -60,6 +61,8 @@ let ten = 10;
 		{token.COLON, ":", createSingleLineRange(6, 16, 1)},
 		{token.STRING, "bar", createSingleLineRange(8, 16, 5)},
 		{token.RBRACE, "}", createSingleLineRange(13, 16, 1)},
+		{token.EOF, "", createSingleLineRange(0, 17, 0)},
+		{token.EOF, "", createSingleLineRange(0, 17, 0)},
 	}
 
 	l := New(input)
@@ -230,3 +233,100 @@ func compareRange(r1, r2 token.Range) bool {
 //		}
 //	}
 //}
+
+func TestComments(t *testing.T) {
+	input := `# hash
+let a = 1; // one
+/* block
+comment */ a / 2 /* inline */ * 3
+// last`
+
+	type Test struct {
+		expectedType     token.TokenType
+		expectedLeading  []string
+		expectedTrailing []string
+	}
+
+	tests := []Test{
+		{token.LET, []string{"# hash"}, nil},
+		{token.IDENT, nil, nil},
+		{token.ASSIGN, nil, nil},
+		{token.INT, nil, nil},
+		{token.SEMICOLON, nil, []string{"// one"}},
+		{token.IDENT, []string{"/* block\ncomment */"}, nil},
+		{token.SLASH, nil, nil},
+		{token.INT, nil, []string{"/* inline */"}},
+		{token.ASTERISK, nil, nil},
+		{token.INT, nil, nil},
+		{token.EOF, []string{"// last"}, nil},
+	}
+
+	l := New(input)
+	tokens := []token.Token{}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if fmt.Sprint(commentTexts(tok.Leading)) != fmt.Sprint(tt.expectedLeading) {
+			t.Fatalf("tests[%d] - leading comments wrong. expected=%q, got=%q",
+				i, tt.expectedLeading, commentTexts(tok.Leading))
+		}
+
+		if fmt.Sprint(commentTexts(tok.Trailing)) != fmt.Sprint(tt.expectedTrailing) {
+			t.Fatalf("tests[%d] - trailing comments wrong. expected=%q, got=%q",
+				i, tt.expectedTrailing, commentTexts(tok.Trailing))
+		}
+	}
+
+	// Positions after a multi-line comment continue on the right line
+	if expected := createSingleLineRange(11, 3, 1); !compareRange(tokens[5].Range, expected) {
+		t.Fatalf("range wrong. expected=%s, got=%s", expected, tokens[5].Range)
+	}
+
+	expected := token.Range{
+		Start: token.Position{Line: 2, Character: 0},
+		End:   token.Position{Line: 3, Character: 10},
+	}
+	if !compareRange(tokens[5].Leading[0].Range, expected) {
+		t.Fatalf("comment range wrong. expected=%s, got=%s", expected, tokens[5].Leading[0].Range)
+	}
+}
+
+func commentTexts(comments []token.Comment) []string {
+	texts := []string{}
+	for _, c := range comments {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	tests := []struct {
+		input        string
+		unterminated bool
+	}{
+		{"/* open\n", true},
+		{"/*/", true},
+		{"/**/", false},
+		{"/* closed */", false},
+		{"// line", false},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if len(tok.Leading) != 1 {
+			t.Fatalf("Expected one comment in %q, got=%q", tt.input, commentTexts(tok.Leading))
+		}
+
+		if tok.Leading[0].IsUnterminated() != tt.unterminated {
+			t.Fatalf("Wrong unterminated for %q, want=%t; got=%t",
+				tt.input, tt.unterminated, tok.Leading[0].IsUnterminated())
+		}
+	}
+}
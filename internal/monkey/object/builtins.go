@@ -1,3 +1,121 @@
 package object
 
+import (
+	"fmt"
+	"io"
+)
+
 var Builtins = []string{"len", "puts", "first", "last", "rest", "push"}
+
+// BuiltinParameters holds parameter names of every builtin function. Names
+// ending with "..." take any number of arguments.
+var BuiltinParameters = map[string][]string{
+	"len":   {"value"},
+	"puts":  {"values..."},
+	"first": {"array"},
+	"last":  {"array"},
+	"rest":  {"array"},
+	"push":  {"array", "value"},
+}
+
+// BuiltinDocs holds Markdown documentation of every builtin function.
+var BuiltinDocs = map[string]string{
+	"len": "```monkey\nlen(value)\n```\n" +
+		"Returns the number of characters of a string or the number of elements of an array.",
+	"puts": "```monkey\nputs(values...)\n```\n" +
+		"Prints every argument on its own line and returns `null`.",
+	"first": "```monkey\nfirst(array)\n```\n" +
+		"Returns the first element of an array, or `null` when the array is empty.",
+	"last": "```monkey\nlast(array)\n```\n" +
+		"Returns the last element of an array, or `null` when the array is empty.",
+	"rest": "```monkey\nrest(array)\n```\n" +
+		"Returns a new array with every element except the first one, or `null` when the array is empty.",
+	"push": "```monkey\npush(array, value)\n```\n" +
+		"Returns a new array with the value appended, the original array is left unchanged.",
+}
+
+var builtinFunctions = map[string]*Builtin{
+	"len": {Fn: func(out io.Writer, args ...Object) Object {
+		if len(args) != 1 {
+			return wrongArgumentCount(len(args), 1)
+		}
+
+		switch arg := args[0].(type) {
+		case *String:
+			return &Integer{Value: int64(len(arg.Value))}
+		case *Array:
+			return &Integer{Value: int64(len(arg.Elements))}
+		default:
+			return newError("argument to `len` not supported, got %s", args[0].Type())
+		}
+	}},
+	"puts": {Fn: func(out io.Writer, args ...Object) Object {
+		for _, arg := range args {
+			fmt.Fprintln(out, arg.Inspect())
+		}
+		return NULL
+	}},
+	"first": {Fn: func(out io.Writer, args ...Object) Object {
+		return withArray("first", args, func(elements []Object) Object {
+			return elements[0]
+		})
+	}},
+	"last": {Fn: func(out io.Writer, args ...Object) Object {
+		return withArray("last", args, func(elements []Object) Object {
+			return elements[len(elements)-1]
+		})
+	}},
+	"rest": {Fn: func(out io.Writer, args ...Object) Object {
+		return withArray("rest", args, func(elements []Object) Object {
+			rest := make([]Object, len(elements)-1)
+			copy(rest, elements[1:])
+			return &Array{Elements: rest}
+		})
+	}},
+	"push": {Fn: func(out io.Writer, args ...Object) Object {
+		if len(args) != 2 {
+			return wrongArgumentCount(len(args), 2)
+		}
+
+		array, ok := args[0].(*Array)
+		if !ok {
+			return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+		}
+
+		elements := make([]Object, len(array.Elements), len(array.Elements)+1)
+		copy(elements, array.Elements)
+		return &Array{Elements: append(elements, args[1])}
+	}},
+}
+
+// GetBuiltinByName returns the implementation of a builtin from Builtins.
+func GetBuiltinByName(name string) (*Builtin, bool) {
+	builtin, ok := builtinFunctions[name]
+	return builtin, ok
+}
+
+// withArray checks the single array argument of a builtin. Empty arrays
+// result in null.
+func withArray(name string, args []Object, f func([]Object) Object) Object {
+	if len(args) != 1 {
+		return wrongArgumentCount(len(args), 1)
+	}
+
+	array, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	if len(array.Elements) == 0 {
+		return NULL
+	}
+	return f(array.Elements)
+}
+
+func wrongArgumentCount(got, want int) *Error {
+	return newError("wrong number of arguments. got=%d, want=%d", got, want)
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,249 @@
+package object
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/code"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ           = "INTEGER"
+	BOOLEAN_OBJ           = "BOOLEAN"
+	STRING_OBJ            = "STRING"
+	NULL_OBJ              = "NULL"
+	ARRAY_OBJ             = "ARRAY"
+	HASH_OBJ              = "HASH"
+	FUNCTION_OBJ          = "FUNCTION"
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	BUILTIN_OBJ           = "BUILTIN"
+	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	ERROR_OBJ             = "ERROR"
+)
+
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// Booleans and null are singletons, so they can be compared by identity.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+func NativeBoolToBooleanObject(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey identifies a hashable object, equal values have equal keys.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by objects that can be used as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// HashPair keeps the original key, so the hash can be printed.
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+
+// Inspect sorts the pairs by their keys, so the output doesn't depend on the
+// iteration order of the map.
+func (h *Hash) Inspect() string {
+	sorted := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		sorted = append(sorted, pair)
+	}
+	slices.SortFunc(sorted, func(a, b HashPair) int {
+		return compareKeys(a.Key, b.Key)
+	})
+
+	pairs := []string{}
+	for _, pair := range sorted {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// compareKeys orders keys by type first, integers by value and the rest by
+// their text.
+func compareKeys(a, b Object) int {
+	if a.Type() != b.Type() {
+		return cmp.Compare(a.Type(), b.Type())
+	}
+
+	if a, ok := a.(*Integer); ok {
+		return cmp.Compare(a.Value, b.(*Integer).Value)
+	}
+
+	return cmp.Compare(a.Inspect(), b.Inspect())
+}
+
+// Function is a closure, it keeps the environment it was defined in.
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// CompiledFunction is the bytecode of a function literal, it's kept in the
+// constants and turned into a Closure when the literal is evaluated.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a compiled function with the free variables it captured.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// BuiltinFunction gets the writer that puts prints to, so the output of a
+// program can be captured.
+type BuiltinFunction func(out io.Writer, args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+// ReturnValue wraps the value of a return statement while it unwinds the
+// blocks it's nested in.
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// Error is a runtime error. Range is the node that failed, errors raised by
+// builtins get the range of the call.
+type Error struct {
+	Message string
+	Range   token.Range
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+func IsError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
@@ -0,0 +1,54 @@
+package object
+
+import "testing"
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypes(t *testing.T) {
+	if (&Integer{Value: 1}).HashKey() == TRUE.HashKey() {
+		t.Errorf("integer and boolean with the same value have same hash keys")
+	}
+}
+
+func TestHashInspectIsSorted(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	keys := []Hashable{
+		&String{Value: "b"},
+		&Integer{Value: 10},
+		TRUE,
+		&String{Value: "a"},
+		&Integer{Value: -1},
+		&Integer{Value: 2},
+		FALSE,
+	}
+	for _, key := range keys {
+		hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: NULL}
+	}
+
+	expected := "{false: null, true: null, -1: null, 2: null, 10: null, a: null, b: null}"
+	for i := 0; i < 10; i++ {
+		if got := hash.Inspect(); got != expected {
+			t.Fatalf("Wrong inspect, want=%s; got=%s", expected, got)
+		}
+	}
+}
+
+func TestBuiltinsAreImplemented(t *testing.T) {
+	for _, name := range Builtins {
+		if _, ok := GetBuiltinByName(name); !ok {
+			t.Errorf("builtin %s has no implementation", name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// attachInnerComments gives every comment that isn't attached to a statement
+// or a block to the innermost statement containing it, so no comment is lost
+// by tools that work with statements.
+func attachInnerComments(program *ast.Program) {
+	attached := map[token.Range]bool{}
+	mark := func(comments []token.Comment) {
+		for _, c := range comments {
+			attached[c.Range] = true
+		}
+	}
+
+	mark(program.Dangling)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if block, ok := node.(*ast.BlockStatement); ok {
+			mark(block.Dangling)
+		}
+		if s, ok := node.(ast.Statement); ok {
+			if trivia := ast.StatementTrivia(s); trivia != nil {
+				mark(trivia.Leading)
+				mark(trivia.Trailing)
+			}
+		}
+		return true
+	})
+
+	for _, comment := range program.Comments {
+		if attached[comment.Range] {
+			continue
+		}
+
+		var innermost *ast.Trivia
+		ast.Inspect(program, func(node ast.Node) bool {
+			if !node.Range().Contains(comment.Range.Start) {
+				return node == program
+			}
+
+			if s, ok := node.(ast.Statement); ok {
+				if trivia := ast.StatementTrivia(s); trivia != nil {
+					innermost = trivia
+				}
+			}
+			return true
+		})
+
+		if innermost != nil {
+			innermost.Inner = append(innermost.Inner, comment)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+type ErrorCode string
+
+const (
+	UnexpectedToken     ErrorCode = "unexpected-token"
+	MissingPrefix       ErrorCode = "missing-expression"
+	InvalidInteger      ErrorCode = "invalid-integer"
+	UnterminatedComment ErrorCode = "unterminated-comment"
+)
+
+type ParserError struct {
+	Message string
+	Range   token.Range
+	Code    ErrorCode
+}
+
+func (pe ParserError) Error() string {
+	return fmt.Sprintf("%s %s", pe.Range, pe.Message)
+}
+
+func (p *Parser) addError(code ErrorCode, rng token.Range, format string, a ...any) {
+	// A single missing token tends to be reported by every construct around it
+	if len(p.errors) > 0 && p.errors[len(p.errors)-1].Range == rng {
+		return
+	}
+
+	p.errors = append(p.errors, ParserError{
+		Message: fmt.Sprintf(format, a...),
+		Range:   rng,
+		Code:    code,
+	})
+}
@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
@@ -36,10 +35,20 @@ var precedences = map[token.TokenType]int{
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []ParserError
 
-	curToken  token.Token
-	peekToken token.Token
+	prevToken    token.Token
+	curToken     token.Token
+	peekToken    token.Token
+	pendingToken *token.Token
+
+	// canBackup is false until the parser advances past the first token of
+	// the current statement, which guarantees that recovery always makes progress
+	canBackup  bool
+	braceDepth int
+
+	// comments are all comments read from the lexer so far
+	comments []token.Comment
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -51,7 +60,7 @@ type (
 )
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []ParserError{}}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
@@ -85,13 +94,56 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []ParserError {
 	return p.errors
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+
+	if p.pendingToken != nil {
+		p.peekToken = *p.pendingToken
+		p.pendingToken = nil
+	} else {
+		p.peekToken = p.l.NextToken()
+		p.addComments(p.peekToken.Leading)
+		p.addComments(p.peekToken.Trailing)
+	}
+
+	p.canBackup = true
+	p.trackBraceDepth(p.curToken, 1)
+}
+
+func (p *Parser) addComments(comments []token.Comment) {
+	for _, comment := range comments {
+		if comment.IsUnterminated() {
+			p.addError(UnterminatedComment, comment.Range, "unterminated comment")
+		}
+	}
+	p.comments = append(p.comments, comments...)
+}
+
+// backup moves the parser one token back. Only a single token of lookbehind
+// is kept, so it can't be called twice without advancing in between.
+func (p *Parser) backup() {
+	pending := p.peekToken
+	p.pendingToken = &pending
+
+	p.trackBraceDepth(p.curToken, -1)
+
+	p.peekToken = p.curToken
+	p.curToken = p.prevToken
+	p.canBackup = false
+}
+
+func (p *Parser) trackBraceDepth(tok token.Token, direction int) {
+	switch tok.Type {
+	case token.LBRACE:
+		p.braceDepth += direction
+	case token.RBRACE:
+		p.braceDepth -= direction
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -107,6 +159,11 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	program.RangeValue = token.Range{End: p.curToken.Range.End}
+	program.Comments = p.comments
+	program.Dangling = p.curToken.Leading
+	attachInnerComments(program)
+
 	return program
 }
 
@@ -119,6 +176,55 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.curToken
+	depth := p.braceDepth
+	errorCount := len(p.errors)
+	p.canBackup = false
+
+	stmt := p.parseStatementKind()
+
+	if len(p.errors) != errorCount {
+		p.synchronize(depth)
+
+		if stmt == nil {
+			stmt = &ast.BadStatement{
+				Token:      start,
+				RangeValue: token.Range{Start: start.Range.Start, End: p.curToken.Range.End},
+			}
+		}
+	}
+
+	if trivia := ast.StatementTrivia(stmt); trivia != nil {
+		trivia.Leading = start.Leading
+		trivia.Trailing = p.curToken.Trailing
+	}
+
+	return stmt
+}
+
+// synchronize skips the rest of a broken statement. It stops at a semicolon or
+// right before a closing brace of the enclosing block, a let or return statement
+// or a token on a new line. Braces opened in the skipped part are skipped as a whole.
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) && !p.peekTokenIs(token.EOF) {
+		if p.braceDepth <= depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+
+			if p.peekTokenIs(token.RBRACE) ||
+				p.peekTokenIs(token.LET) ||
+				p.peekTokenIs(token.RETURN) ||
+				p.peekToken.Range.Start.Line > p.curToken.Range.End.Line {
+				return
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		if res := p.parseLetStatement(); res != nil {
@@ -155,11 +261,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 	p.nextToken()
 
-	value := p.parseExpression(LOWEST)
-	if value == nil {
-		return nil
-	}
-	stmt.Value = value
+	stmt.Value = p.parseExpression(LOWEST)
 
 	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
 		fl.Name = stmt.Name.Value
@@ -181,11 +283,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	p.nextToken()
 
-	returnValue := p.parseExpression(LOWEST)
-	if returnValue == nil {
-		return nil
-	}
-	stmt.ReturnValue = returnValue
+	stmt.ReturnValue = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -202,11 +300,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	startPosition := p.curToken.Range.Start
 
-	result := p.parseExpression(LOWEST)
-	if result == nil {
-		return nil
-	}
-	stmt.Expression = result
+	stmt.Expression = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -219,19 +313,22 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(MissingPrefix, p.curToken.Range, "no prefix parse function for %s found", t)
 }
 
+// parseExpression never returns nil, expressions that fail to parse are
+// replaced by *ast.BadExpression spanning the consumed tokens.
 func (p *Parser) parseExpression(presedence int) ast.Expression {
+	start := p.curToken
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		return p.parseMissingExpression()
 	}
 	leftExp := prefix()
 	if leftExp == nil {
-		return nil
+		return p.newBadExpression(start)
 	}
 
 	for !p.peekTokenIs(token.SEMICOLON) && presedence < p.peekPrecedence() {
@@ -242,11 +339,46 @@ func (p *Parser) parseExpression(presedence int) ast.Expression {
 		p.nextToken()
 
 		leftExp = infix(leftExp)
+		if leftExp == nil {
+			return p.newBadExpression(start)
+		}
 	}
 
 	return leftExp
 }
 
+// parseMissingExpression handles a token that can't start an expression. Tokens
+// that close or separate something, or start a new statement, are left for the
+// enclosing construct, so `let x = }` doesn't swallow the end of a block.
+func (p *Parser) parseMissingExpression() ast.Expression {
+	bad := &ast.BadExpression{Token: p.curToken, RangeValue: p.curToken.Range}
+
+	if endsExpression(p.curToken.Type) && p.canBackup {
+		p.backup()
+		end := p.curToken.Range.End
+		bad.RangeValue = token.Range{Start: end, End: end}
+	}
+
+	return bad
+}
+
+func (p *Parser) newBadExpression(start token.Token) ast.Expression {
+	return &ast.BadExpression{
+		Token:      start,
+		RangeValue: token.Range{Start: start.Range.Start, End: p.curToken.Range.End},
+	}
+}
+
+func endsExpression(t token.TokenType) bool {
+	switch t {
+	case token.RPAREN, token.RBRACE, token.RBRACKET, token.SEMICOLON, token.COMMA, token.EOF:
+		return true
+	case token.LET, token.RETURN:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{
 		Token:      p.curToken,
@@ -260,8 +392,12 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(
+			InvalidInteger,
+			p.curToken.Range,
+			"could not parse %q as integer",
+			p.curToken.Literal,
+		)
 		return nil
 	}
 	lit.Value = value
@@ -278,11 +414,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 	p.nextToken()
 
-	exprRight := p.parseExpression(PREFIX)
-	if exprRight == nil {
-		return nil
-	}
-	expression.Right = exprRight
+	expression.Right = p.parseExpression(PREFIX)
 
 	endPosition := expression.Right.Range().End
 	expression.RangeValue = token.Range{Start: startPosition, End: endPosition}
@@ -300,11 +432,7 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 
 	precedence := p.curPrecedence()
 	p.nextToken()
-	exprRight := p.parseExpression(precedence)
-	if exprRight == nil {
-		return nil
-	}
-	expression.Right = exprRight
+	expression.Right = p.parseExpression(precedence)
 
 	endPosition := expression.Right.Range().End
 	expression.RangeValue = token.Range{Start: startPosition, End: endPosition}
@@ -341,11 +469,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 
 	p.nextToken()
-	result := p.parseExpression(LOWEST)
-	if result == nil {
-		return nil
-	}
-	expression.Condition = result
+	expression.Condition = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
@@ -377,6 +501,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block.Statements = []ast.Statement{}
 	startPosition := p.curToken.Range.Start
 
+	// Comments after the opening brace belong to what follows it
+	opening := p.curToken.Trailing
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -387,6 +514,25 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+
+	if p.curTokenIs(token.EOF) {
+		p.addError(
+			UnexpectedToken,
+			p.curToken.Range,
+			"expected %s to close the block, got %s instead",
+			token.RBRACE,
+			p.curToken.Type,
+		)
+	}
+
+	if len(block.Statements) > 0 {
+		if trivia := ast.StatementTrivia(block.Statements[0]); trivia != nil {
+			trivia.Leading = append(opening, trivia.Leading...)
+			opening = nil
+		}
+	}
+	block.Dangling = append(opening, p.curToken.Leading...)
+
 	endPosition := p.curToken.Range.End
 	block.RangeValue = token.Range{Start: startPosition, End: endPosition}
 
@@ -423,7 +569,9 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	ident := &ast.Identifier{
 		Token:      p.curToken,
@@ -434,7 +582,9 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		ident := &ast.Identifier{
 			Token:      p.curToken,
 			Value:      p.curToken.Literal,
@@ -486,11 +636,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	startPosition := p.curToken.Range.Start
 
 	p.nextToken()
-	result := p.parseExpression(LOWEST)
-	if result == nil {
-		return nil
-	}
-	exp.Index = result
+	exp.Index = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -519,9 +665,8 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(end) {
-		return nil
-	}
+	// The partial list is kept so that unfinished calls still have their arguments
+	p.expectPeek(end)
 
 	return list
 }
@@ -534,9 +679,6 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
-		if key == nil {
-			return nil
-		}
 
 		if !p.expectPeek(token.COLON) {
 			return nil
@@ -544,9 +686,6 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
-		if value == nil {
-			return nil
-		}
 
 		hash.Pairs[key] = value
 
@@ -584,8 +723,13 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(
+		UnexpectedToken,
+		p.peekToken.Range,
+		"expected next token to be %s, got %s instead",
+		t,
+		p.peekToken.Type,
+	)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -1103,6 +1103,210 @@ func TestFunctionLiteralWithName(t *testing.T) {
 	}
 }
 
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedCode  ErrorCode
+		expectedRange token.Range
+	}{
+		{"let = 5;", UnexpectedToken, createSingleLineRange(4, 0, 1)},
+		{"add(1, 2", UnexpectedToken, createSingleLineRange(8, 0, 0)},
+		{"let x = ;", MissingPrefix, createSingleLineRange(8, 0, 1)},
+		{"let x = 99999999999999999999;", InvalidInteger, createSingleLineRange(8, 0, 20)},
+		{"let x = 5;\nif (x { x }", UnexpectedToken, createSingleLineRange(6, 1, 1)},
+		{"let x = 5; /* open", UnterminatedComment, createSingleLineRange(11, 0, 7)},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		if errors[0].Code != tt.expectedCode {
+			t.Errorf("error code wrong for %q. want=%s, got=%s",
+				tt.input, tt.expectedCode, errors[0].Code)
+		}
+
+		if !testRange(errors[0].Range, tt.expectedRange) {
+			t.Errorf("error range wrong for %q. want=%s, got=%s",
+				tt.input, tt.expectedRange, errors[0].Range)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedTypes []string
+	}{
+		{"let x = ;\nlet y = 5;", []string{"*ast.LetStatement", "*ast.LetStatement"}},
+		{"let = 5;\nlet y = 5;", []string{"*ast.BadStatement", "*ast.LetStatement"}},
+		{"if (x { y }\nlet z = 2", []string{"*ast.ExpressionStatement", "*ast.LetStatement"}},
+		{"let f = fn(a) {\n  let b = a +\n}\nlet c = 1", []string{"*ast.LetStatement", "*ast.LetStatement"}},
+		{"let a = ) 1 2\nreturn a;", []string{"*ast.LetStatement", "*ast.ReturnStatement"}},
+		{"}\nlet a = 1", []string{"*ast.ExpressionStatement", "*ast.LetStatement"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		if len(program.Statements) != len(tt.expectedTypes) {
+			t.Fatalf("program.Statements for %q does not contain %d statements. got=%d (%q)",
+				tt.input, len(tt.expectedTypes), len(program.Statements), program.String())
+		}
+
+		for i, expected := range tt.expectedTypes {
+			actual := fmt.Sprintf("%T", program.Statements[i])
+			if actual != expected {
+				t.Errorf("program.Statements[%d] for %q is not %s. got=%s",
+					i, tt.input, expected, actual)
+			}
+		}
+	}
+}
+
+func TestErrorRecoveryKeepsFunctionBody(t *testing.T) {
+	input := `let f = fn(a) {
+  let b = a +
+  let c = ;
+  c
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 2 {
+		t.Fatalf("parser should have 2 errors. got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+			len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if len(function.Body.Statements) != 3 {
+		t.Fatalf("function.Body.Statements has not 3 statements. got=%d",
+			len(function.Body.Statements))
+	}
+
+	expRange := createMultiLineRange(14, 0, 1, 5)
+	if !testRange(function.Body.Range(), expRange) {
+		t.Fatalf("function.Body.Range not %s. got=%s", expRange, function.Body.Range())
+	}
+
+	infix, ok := function.Body.Statements[0].(*ast.LetStatement).Value.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("first body statement value is not ast.InfixExpression. got=%T",
+			function.Body.Statements[0].(*ast.LetStatement).Value)
+	}
+
+	if _, ok := infix.Right.(*ast.BadExpression); !ok {
+		t.Fatalf("infix.Right is not ast.BadExpression. got=%T", infix.Right)
+	}
+}
+
+func TestUnfinishedCallKeepsArguments(t *testing.T) {
+	input := "add(1, "
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("parser should have 1 error. got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if len(call.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments. got=%d", len(call.Arguments))
+	}
+
+	testLiteralExpression(t, call.Arguments[0], 1)
+	if _, ok := call.Arguments[1].(*ast.BadExpression); !ok {
+		t.Fatalf("call.Arguments[1] is not ast.BadExpression. got=%T", call.Arguments[1])
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// doc
+let f = fn(x) { // opening
+  let y = [x, // element
+    1];
+  y // value
+  // end of body
+}; // after f
+// end`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Comments) != 7 {
+		t.Fatalf("program.Comments has wrong length. got=%d", len(program.Comments))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	testComments(t, "let.Leading", let.Leading, "// doc")
+	testComments(t, "let.Trailing", let.Trailing, "// after f")
+	testComments(t, "program.Dangling", program.Dangling, "// end")
+
+	body := let.Value.(*ast.FunctionLiteral).Body
+	testComments(t, "body.Dangling", body.Dangling, "// end of body")
+
+	inner := body.Statements[0].(*ast.LetStatement)
+	testComments(t, "inner.Leading", inner.Leading, "// opening")
+	testComments(t, "inner.Inner", inner.Inner, "// element")
+	testComments(t, "inner.Trailing", inner.Trailing)
+
+	value := body.Statements[1].(*ast.ExpressionStatement)
+	testComments(t, "value.Trailing", value.Trailing, "// value")
+
+	programRange := token.Range{End: token.Position{Line: 7, Character: 6}}
+	if program.Range() != programRange {
+		t.Fatalf("program.Range() should cover comments. want=%s, got=%s", programRange, program.Range())
+	}
+
+	fullRange := ast.FullRange(let)
+	if fullRange.Start.Line != 0 || fullRange.End != (token.Position{Line: 6, Character: 13}) {
+		t.Fatalf("wrong full range of let. got=%s", fullRange)
+	}
+}
+
+func testComments(t *testing.T, name string, comments []token.Comment, expected ...string) {
+	texts := []string{}
+	for _, c := range comments {
+		texts = append(texts, c.Text)
+	}
+
+	if fmt.Sprint(texts) != fmt.Sprint(expected) {
+		t.Fatalf("%s has wrong comments. want=%q, got=%q", name, expected, texts)
+	}
+}
+
 func testRange(r1, r2 token.Range) bool {
 	return r1.String() == r2.String()
 }
@@ -1201,7 +1405,7 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	t.Errorf("parser had %d errors", len(errors))
 	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+		t.Errorf("parser error: %q", msg.Message)
 	}
 	t.FailNow()
 }
@@ -1,6 +1,9 @@
 package token
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type TokenType string
 
@@ -8,6 +11,30 @@ type Token struct {
 	Type    TokenType
 	Range   Range
 	Literal string
+
+	// Leading are the comments between the previous token and this one,
+	// Trailing are the comments that follow this token on the same line
+	Leading  []Comment
+	Trailing []Comment
+}
+
+// Comment is a line ("//" or "#") or block ("/* */") comment. Comments aren't
+// tokens, they are kept as trivia of the tokens around them.
+type Comment struct {
+	// Text includes the delimiters
+	Text  string
+	Range Range
+}
+
+// IsBlock reports whether the comment is a block comment.
+func (c Comment) IsBlock() bool {
+	return strings.HasPrefix(c.Text, "/*")
+}
+
+// IsUnterminated reports whether the comment is a block comment that runs to
+// the end of input without the closing "*/".
+func (c Comment) IsUnterminated() bool {
+	return c.IsBlock() && (len(c.Text) < len("/**/") || !strings.HasSuffix(c.Text, "*/"))
 }
 
 type Range struct {
@@ -85,6 +112,17 @@ func (r Range) String() string {
 	)
 }
 
+// Before reports whether p comes strictly before other.
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || (p.Line == other.Line && p.Character < other.Character)
+}
+
+// Contains reports whether the position lies in the range, including its end,
+// so a cursor placed right after a token still points at it.
+func (r Range) Contains(position Position) bool {
+	return !position.Before(r.Start) && !r.End.Before(position)
+}
+
 func LookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
 		return tok
@@ -0,0 +1,12 @@
+package types
+
+// builtins describes the signatures of object.Builtins. Return types that
+// depend on the arguments are refined in checkBuiltinCall.
+var builtins = map[string]*Function{
+	"len":   {Params: []Type{Unknown}, Return: Integer},
+	"puts":  {Return: Null, Variadic: true},
+	"first": {Params: []Type{&Array{Element: Unknown}}, Return: Unknown},
+	"last":  {Params: []Type{&Array{Element: Unknown}}, Return: Unknown},
+	"rest":  {Params: []Type{&Array{Element: Unknown}}, Return: &Array{Element: Unknown}},
+	"push":  {Params: []Type{&Array{Element: Unknown}, Unknown}, Return: &Array{Element: Unknown}},
+}
@@ -0,0 +1,522 @@
+package types
+
+import (
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+// key identifies a binding the same way the compiler does, by its name and
+// the range of the identifier that defines it.
+type key struct {
+	name       string
+	definition token.Range
+}
+
+func keyOf(symbol compiler.Symbol) key {
+	return key{name: symbol.Name, definition: symbol.Range}
+}
+
+// Checker infers types of a compiled program. Scopes aren't tracked here,
+// every identifier is looked up through the compiler, so the program has to be
+// compiled first.
+type Checker struct {
+	compiler *compiler.Compiler
+
+	bindings    map[key]Type
+	expressions map[ast.Expression]Type
+	literals    map[key]*ast.FunctionLiteral
+
+	// arguments holds joined types of arguments from every call of a function
+	// literal, they are used as types of its parameters
+	arguments map[*ast.FunctionLiteral][]Type
+
+	// returns is a stack of joined return types of the enclosing functions
+	returns []Type
+
+	// recursive holds bindings that may be referenced from their own function
+	// literal, only those need the return type before the body is inferred
+	recursive map[key]bool
+
+	// prepass is set while a recursive literal is inferred to find out its
+	// return type, literals nested in it aren't inferred in advance again,
+	// otherwise nesting would cost exponential time
+	prepass bool
+
+	errors []TypeError
+
+	// collect is set in the first pass, report in the second one
+	collect bool
+	report  bool
+}
+
+// Check infers types of the program in two passes. The first one only collects
+// argument types of calls, the second one uses them as parameter types and
+// reports errors.
+func Check(program *ast.Program, comp *compiler.Compiler) *Checker {
+	c := &Checker{
+		compiler:  comp,
+		arguments: map[*ast.FunctionLiteral][]Type{},
+		recursive: selfReferences(program, comp),
+	}
+
+	for _, report := range []bool{false, true} {
+		c.bindings = map[key]Type{}
+		c.expressions = map[ast.Expression]Type{}
+		c.literals = map[key]*ast.FunctionLiteral{}
+		c.errors = []TypeError{}
+		c.collect = !report
+		c.report = report
+
+		c.inferStatements(program.Statements)
+	}
+
+	return c
+}
+
+func (c *Checker) Errors() []TypeError {
+	return c.errors
+}
+
+// TypeOf returns the inferred type of an expression.
+func (c *Checker) TypeOf(expr ast.Expression) Type {
+	if t, ok := c.expressions[expr]; ok {
+		return t
+	}
+	return Unknown
+}
+
+// TypeOfSymbol returns the type of the value bound to the symbol.
+func (c *Checker) TypeOfSymbol(symbol compiler.Symbol) Type {
+	if symbol.Scope == compiler.BuiltinScope {
+		if f, ok := builtins[symbol.Name]; ok {
+			return f
+		}
+		return Unknown
+	}
+
+	if t, ok := c.bindings[keyOf(symbol)]; ok {
+		return t
+	}
+	return Unknown
+}
+
+// inferStatements returns the type of the last statement, which is the value
+// of a block.
+func (c *Checker) inferStatements(statements []ast.Statement) Type {
+	var result Type = Null
+
+	for _, s := range statements {
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			c.inferLet(s)
+			result = Null
+
+		case *ast.ReturnStatement:
+			result = c.infer(s.ReturnValue)
+			if len(c.returns) > 0 {
+				top := len(c.returns) - 1
+				c.returns[top] = Join(c.returns[top], result)
+			}
+
+		case *ast.ExpressionStatement:
+			result = c.infer(s.Expression)
+
+		default:
+			result = Unknown
+		}
+	}
+
+	return result
+}
+
+func (c *Checker) inferLet(node *ast.LetStatement) {
+	if node.Name == nil {
+		c.infer(node.Value)
+		return
+	}
+
+	// Recursive calls need the return type before the body is inferred, so
+	// the body is inferred once without reporting errors to find it out
+	if literal, ok := node.Value.(*ast.FunctionLiteral); ok {
+		if symbol, ok := c.compiler.ResolveIdentifier(node.Name); ok {
+			c.literals[keyOf(symbol)] = literal
+			c.bind(node.Name, &Function{Params: c.parameterTypes(literal), Return: pending})
+
+			if c.recursive[keyOf(symbol)] && !c.prepass {
+				report := c.report
+				c.report = false
+				c.prepass = true
+
+				c.bind(node.Name, resolvePending(c.infer(literal)))
+
+				c.report = report
+				c.prepass = false
+			}
+		}
+	}
+
+	t := c.infer(node.Value)
+	if c.prepass {
+		t = resolvePending(t)
+	}
+	c.bind(node.Name, t)
+}
+
+// selfReferences returns bindings referenced by the name a function literal
+// gets in its own body, directly or from a closure nested in it. Captured
+// variables are included too, which is harmless, they are only checked for
+// function literals.
+func selfReferences(program *ast.Program, comp *compiler.Compiler) map[key]bool {
+	recursive := map[key]bool{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			symbol, ok := comp.ResolveIdentifier(ident)
+			if ok && (symbol.Scope == compiler.FunctionScope || symbol.Scope == compiler.FreeScope) {
+				recursive[keyOf(symbol)] = true
+			}
+		}
+		return true
+	})
+
+	return recursive
+}
+
+func (c *Checker) bind(ident *ast.Identifier, t Type) {
+	c.expressions[ident] = t
+
+	if symbol, ok := c.compiler.ResolveIdentifier(ident); ok {
+		c.bindings[keyOf(symbol)] = t
+	}
+}
+
+func (c *Checker) infer(node ast.Expression) Type {
+	if node == nil {
+		return Unknown
+	}
+
+	var result Type
+
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		result = Integer
+
+	case *ast.StringLiteral:
+		result = String
+
+	case *ast.Boolean:
+		result = Boolean
+
+	case *ast.Identifier:
+		result = Unknown
+		if symbol, ok := c.compiler.ResolveIdentifier(node); ok {
+			result = c.TypeOfSymbol(symbol)
+		}
+
+	case *ast.PrefixExpression:
+		result = c.inferPrefix(node)
+
+	case *ast.InfixExpression:
+		result = c.inferInfix(node)
+
+	case *ast.IfExpression:
+		c.infer(node.Condition)
+
+		result = c.inferBlock(node.Consequence)
+		if node.Alternative != nil {
+			result = Join(result, c.inferBlock(node.Alternative))
+		} else {
+			result = Join(result, Null)
+		}
+
+	case *ast.FunctionLiteral:
+		result = c.inferFunction(node)
+
+	case *ast.CallExpression:
+		result = c.inferCall(node)
+
+	case *ast.ArrayLiteral:
+		var element Type
+		for _, e := range node.Elements {
+			element = Join(element, c.infer(e))
+		}
+		result = &Array{Element: element}
+
+	case *ast.HashLiteral:
+		hash := &Hash{}
+		for _, k := range node.SortedKeys() {
+			keyType := c.infer(k)
+			c.checkHashKey(k, keyType)
+
+			hash.Key = Join(hash.Key, keyType)
+			hash.Value = Join(hash.Value, c.infer(node.Pairs[k]))
+		}
+		result = hash
+
+	case *ast.IndexExpression:
+		result = c.inferIndex(node)
+
+	default:
+		result = Unknown
+	}
+
+	c.expressions[node] = result
+	return result
+}
+
+func (c *Checker) inferBlock(block *ast.BlockStatement) Type {
+	if block == nil {
+		return Unknown
+	}
+	return c.inferStatements(block.Statements)
+}
+
+func (c *Checker) inferPrefix(node *ast.PrefixExpression) Type {
+	right := c.infer(node.Right)
+
+	switch node.Operator {
+	case "!":
+		return Boolean
+
+	case "-":
+		if IsConcrete(right) && right != Integer {
+			c.addError(InvalidOperation, node.Range(), "unknown operator: -%s", right)
+		}
+		return Integer
+	}
+
+	return Unknown
+}
+
+func (c *Checker) inferInfix(node *ast.InfixExpression) Type {
+	left := c.infer(node.Left)
+	right := c.infer(node.Right)
+
+	var result Type
+	switch node.Operator {
+	case "==", "!=":
+		return Boolean
+	case "<", ">":
+		result = Boolean
+	case "+":
+		result = Unknown
+		switch {
+		case left == String || right == String:
+			result = String
+		case left == Integer || right == Integer:
+			result = Integer
+		case left == pending && right == pending:
+			result = pending
+		}
+	default:
+		result = Integer
+	}
+
+	if !IsConcrete(left) || !IsConcrete(right) {
+		return result
+	}
+
+	_, leftBasic := left.(Basic)
+	_, rightBasic := right.(Basic)
+
+	switch {
+	case leftBasic && rightBasic && left != right:
+		c.addError(InvalidOperation, node.Range(),
+			"type mismatch: %s %s %s", left, node.Operator, right)
+	case left == Integer && right == Integer:
+	case left == String && right == String && node.Operator == "+":
+	default:
+		c.addError(InvalidOperation, node.Range(),
+			"unknown operator: %s %s %s", left, node.Operator, right)
+	}
+
+	return result
+}
+
+func (c *Checker) parameterTypes(node *ast.FunctionLiteral) []Type {
+	arguments := c.arguments[node]
+
+	params := make([]Type, len(node.Parameters))
+	for i := range node.Parameters {
+		params[i] = Unknown
+		if i < len(arguments) && arguments[i] != nil {
+			params[i] = arguments[i]
+		}
+	}
+
+	return params
+}
+
+func (c *Checker) inferFunction(node *ast.FunctionLiteral) Type {
+	params := c.parameterTypes(node)
+	for i, p := range node.Parameters {
+		c.bind(p, params[i])
+	}
+
+	c.returns = append(c.returns, nil)
+	last := c.inferBlock(node.Body)
+
+	top := len(c.returns) - 1
+	returned := c.returns[top]
+	c.returns = c.returns[:top]
+
+	return &Function{Params: params, Return: Join(returned, last)}
+}
+
+func (c *Checker) inferCall(node *ast.CallExpression) Type {
+	callee := c.infer(node.Function)
+
+	args := []Type{}
+	for _, a := range node.Arguments {
+		args = append(args, c.infer(a))
+	}
+
+	if c.collect {
+		c.recordArguments(node.Function, args)
+	}
+
+	if ident, ok := node.Function.(*ast.Identifier); ok {
+		symbol, ok := c.compiler.ResolveIdentifier(ident)
+		if ok && symbol.Scope == compiler.BuiltinScope {
+			return c.checkBuiltinCall(symbol.Name, node, args)
+		}
+	}
+
+	if f, ok := callee.(*Function); ok {
+		c.checkArity(f, node, args)
+		return f.Return
+	}
+
+	if IsConcrete(callee) {
+		c.addError(NotCallable, node.Function.Range(),
+			"%s is not a function, got %s", node.Function, callee)
+	}
+
+	return Unknown
+}
+
+func (c *Checker) recordArguments(callee ast.Expression, args []Type) {
+	var literal *ast.FunctionLiteral
+
+	switch callee := callee.(type) {
+	case *ast.FunctionLiteral:
+		literal = callee
+	case *ast.Identifier:
+		if symbol, ok := c.compiler.ResolveIdentifier(callee); ok {
+			literal = c.literals[keyOf(symbol)]
+		}
+	}
+
+	if literal == nil {
+		return
+	}
+
+	joined := c.arguments[literal]
+	for len(joined) < len(literal.Parameters) {
+		joined = append(joined, nil)
+	}
+
+	for i := range literal.Parameters {
+		if i < len(args) {
+			joined[i] = Join(joined[i], args[i])
+		}
+	}
+
+	c.arguments[literal] = joined
+}
+
+func (c *Checker) checkArity(f *Function, node *ast.CallExpression, args []Type) {
+	if f.Variadic || len(args) == len(f.Params) {
+		return
+	}
+
+	c.addError(WrongArgumentCount, node.Range(),
+		"wrong number of arguments: want=%d, got=%d", len(f.Params), len(args))
+}
+
+func (c *Checker) checkBuiltinCall(name string, node *ast.CallExpression, args []Type) Type {
+	f := builtins[name]
+	c.checkArity(f, node, args)
+
+	if len(args) == 0 || name == "puts" {
+		return f.Return
+	}
+
+	arg := args[0]
+	if name == "len" {
+		if _, ok := arg.(*Array); IsConcrete(arg) && arg != String && !ok {
+			c.addError(InvalidArgument, node.Arguments[0].Range(),
+				"argument to `len` not supported, got %s", arg)
+		}
+		return f.Return
+	}
+
+	array, ok := arg.(*Array)
+	if !ok {
+		if IsConcrete(arg) {
+			c.addError(InvalidArgument, node.Arguments[0].Range(),
+				"argument to `%s` must be array, got %s", name, arg)
+		}
+		return f.Return
+	}
+
+	switch name {
+	case "first", "last":
+		if array.Element == nil {
+			return Null
+		}
+		return array.Element
+
+	case "rest":
+		return array
+
+	case "push":
+		if len(args) < 2 {
+			return array
+		}
+		return &Array{Element: Join(array.Element, args[1])}
+	}
+
+	return f.Return
+}
+
+func (c *Checker) inferIndex(node *ast.IndexExpression) Type {
+	left := c.infer(node.Left)
+	index := c.infer(node.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		if IsConcrete(index) && index != Integer {
+			c.addError(InvalidIndex, node.Index.Range(),
+				"array index must be int, got %s", index)
+		}
+
+		if left.Element == nil {
+			return Null
+		}
+		return left.Element
+
+	case *Hash:
+		c.checkHashKey(node.Index, index)
+
+		if left.Value == nil {
+			return Null
+		}
+		return left.Value
+	}
+
+	if IsConcrete(left) {
+		c.addError(NotIndexable, node.Left.Range(), "index operator not supported: %s", left)
+	}
+
+	return Unknown
+}
+
+func (c *Checker) checkHashKey(node ast.Expression, t Type) {
+	if !IsConcrete(t) || t == Integer || t == String || t == Boolean {
+		return
+	}
+
+	c.addError(UnhashableKey, node.Range(), "unusable as hash key: %s", t)
+}
@@ -0,0 +1,172 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+)
+
+var (
+	buff       bytes.Buffer
+	MockLogger = log.New(&buff, "", log.LstdFlags)
+)
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + 2`, "int"},
+		{`"a" + "b"`, "string"},
+		{`1 < 2`, "bool"},
+		{`!5`, "bool"},
+		{`[1, 2, 3]`, "[int]"},
+		{`[1, "a"]`, "[int | string]"},
+		{`[]`, "[]"},
+		{`{"a": 1, "b": 2}`, "{string: int}"},
+		{`let a = [1, 2]; a[0]`, "int"},
+		{`let h = {"a": true}; h["a"]`, "bool"},
+		{`if (true) { 1 }`, "int | null"},
+		{`if (true) { 1 } else { 2 }`, "int"},
+		{`let f = fn(a, b) { a + b }; f`, "fn(unknown, unknown) -> unknown"},
+		{`let f = fn(a, b) { a + b }; f(1, 2); f`, "fn(int, int) -> int"},
+		{`let f = fn(a) { return "a"; 1 }; f`, "fn(unknown) -> string | int"},
+		{`let f = fn() { }; f()`, "null"},
+		{`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10); fib`,
+			"fn(int) -> int"},
+		{`let f = fn(x) { fn(y) { x + y } }; f(1)`, "fn(unknown) -> int"},
+		{`len("abc")`, "int"},
+		{`first([1, 2])`, "int"},
+		{`rest(["a"])`, "[string]"},
+		{`push([], 1)`, "[int]"},
+		{`puts(1)`, "null"},
+		{`len`, "fn(unknown) -> int"},
+	}
+
+	for _, tt := range tests {
+		program, checker := check(t, tt.input)
+
+		last := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+		if got := checker.TypeOf(last.Expression).String(); got != tt.expected {
+			t.Fatalf("Wrong type of %q, want=%s; got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []ErrorCode
+	}{
+		{`"a" - 1`, []ErrorCode{InvalidOperation}},
+		{`"a" - "b"`, []ErrorCode{InvalidOperation}},
+		{`true + false`, []ErrorCode{InvalidOperation}},
+		{`-"a"`, []ErrorCode{InvalidOperation}},
+		{`1 == "a"`, []ErrorCode{}},
+		{`let a = 1; a()`, []ErrorCode{NotCallable}},
+		{`"a"(1)`, []ErrorCode{NotCallable}},
+		{`let a = 1; a[0]`, []ErrorCode{NotIndexable}},
+		{`[1]["a"]`, []ErrorCode{InvalidIndex}},
+		{`{[1]: 2}`, []ErrorCode{UnhashableKey}},
+		{`let f = fn(a) { a }; f(1, 2)`, []ErrorCode{WrongArgumentCount}},
+		{`len(1)`, []ErrorCode{InvalidArgument}},
+		{`first("a")`, []ErrorCode{InvalidArgument}},
+		{`len()`, []ErrorCode{WrongArgumentCount}},
+		{`let f = fn(x) { x - 1 }; f("a")`, []ErrorCode{InvalidOperation}},
+		// x is either a string or an integer, it could be fine
+		{`let f = fn(x) { x - 1 }; f("a"); f(1)`, []ErrorCode{}},
+		{`let f = fn(x) { x(1) }; f(len)`, []ErrorCode{}},
+		{`let a = b; a - "c"`, []ErrorCode{}},
+		{`let a = b + 1; a - "c"`, []ErrorCode{InvalidOperation}},
+	}
+
+	for _, tt := range tests {
+		_, checker := check(t, tt.input)
+
+		errors := checker.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Fatalf("Wrong number of errors in %q, want=%d; got=%v", tt.input, len(tt.expected), errors)
+		}
+
+		for i, code := range tt.expected {
+			if errors[i].Code != code {
+				t.Fatalf("Wrong error code in %q, want=%s; got=%s", tt.input, code, errors[i].Code)
+			}
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		a, b     Type
+		expected string
+	}{
+		{Integer, Integer, "int"},
+		{nil, String, "string"},
+		{Integer, Unknown, "unknown"},
+		{Integer, String, "int | string"},
+		{&Union{Types: []Type{Integer, String}}, Integer, "int | string"},
+		{&Array{}, &Array{Element: Boolean}, "[bool]"},
+		{&Union{Types: []Type{Integer, String, Boolean, Null}}, &Array{}, "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := Join(tt.a, tt.b).String(); got != tt.expected {
+			t.Fatalf("Wrong join of %s and %s, want=%s; got=%s", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func check(t *testing.T, input string) (*ast.Program, *Checker) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors in %q: %v", input, p.Errors())
+	}
+
+	comp := compiler.New(MockLogger)
+	if err := comp.Compile(program); err != nil {
+		t.Fatal(err)
+	}
+
+	return program, Check(program, comp)
+}
+
+// Each nesting level used to double the work, so these would never finish.
+func TestDeeplyNestedFunctions(t *testing.T) {
+	const depth = 40
+
+	// Identifiers can't contain digits
+	name := func(level int) string { return strings.Repeat("f", level+1) }
+
+	plain := "x + 1"
+	recursive := fmt.Sprintf("if (n < 1) { 0 } else { %s(n - 1) }", name(depth))
+	for i := depth - 1; i >= 0; i-- {
+		plain = fmt.Sprintf("let %s = fn(x) { %s }; %s(x)", name(i+1), plain, name(i+1))
+		recursive = fmt.Sprintf(
+			"let %s = fn(n) { %s }; if (n < 1) { %s(n) } else { %s(n - 1) }",
+			name(i+1), recursive, name(i+1), name(i),
+		)
+	}
+
+	tests := []string{
+		fmt.Sprintf("let f = fn(x) { %s }; f(1)", plain),
+		fmt.Sprintf("let f = fn(n) { %s }; f(1)", recursive),
+	}
+
+	for _, input := range tests {
+		program, checker := check(t, input)
+
+		last := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+		if got := checker.TypeOf(last.Expression).String(); got != "int" {
+			t.Fatalf("Wrong type of nested functions, want=int; got=%s", got)
+		}
+	}
+}
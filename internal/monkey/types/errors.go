@@ -0,0 +1,41 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+type ErrorCode string
+
+const (
+	InvalidOperation   ErrorCode = "invalid-operation"
+	NotCallable        ErrorCode = "not-callable"
+	WrongArgumentCount ErrorCode = "wrong-argument-count"
+	InvalidArgument    ErrorCode = "invalid-argument"
+	NotIndexable       ErrorCode = "not-indexable"
+	InvalidIndex       ErrorCode = "invalid-index"
+	UnhashableKey      ErrorCode = "unhashable-key"
+)
+
+type TypeError struct {
+	Message string
+	Range   token.Range
+	Code    ErrorCode
+}
+
+func (te TypeError) Error() string {
+	return fmt.Sprintf("%s %s", te.Range, te.Message)
+}
+
+func (c *Checker) addError(code ErrorCode, rng token.Range, format string, a ...any) {
+	if !c.report {
+		return
+	}
+
+	c.errors = append(c.errors, TypeError{
+		Message: fmt.Sprintf(format, a...),
+		Range:   rng,
+		Code:    code,
+	})
+}
@@ -0,0 +1,241 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxUnionSize limits how many alternatives a union keeps before it gives up
+// and becomes Unknown.
+const maxUnionSize = 4
+
+type Type interface {
+	String() string
+}
+
+// Basic types are compared by value.
+type Basic string
+
+const (
+	Unknown Basic = "unknown"
+	Integer Basic = "int"
+	String  Basic = "string"
+	Boolean Basic = "bool"
+	Null    Basic = "null"
+
+	// pending is the return type of a recursive function while its body is
+	// inferred. Unlike Unknown it joins to the other type.
+	pending Basic = "pending"
+)
+
+func (b Basic) String() string { return string(b) }
+
+// Array of an empty array literal has a nil element type.
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string {
+	if a.Element == nil {
+		return "[]"
+	}
+	return fmt.Sprintf("[%s]", a.Element)
+}
+
+// Hash of an empty hash literal has nil key and value types.
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string {
+	if h.Key == nil || h.Value == nil {
+		return "{}"
+	}
+	return fmt.Sprintf("{%s: %s}", h.Key, h.Value)
+}
+
+type Function struct {
+	Params   []Type
+	Return   Type
+	Variadic bool
+}
+
+func (f *Function) String() string {
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+
+	if f.Variadic {
+		params = append(params, "...")
+	}
+
+	return fmt.Sprintf("fn(%s) -> %s", strings.Join(params, ", "), f.Return)
+}
+
+// Union holds at least two distinct types, none of which is a union.
+type Union struct {
+	Types []Type
+}
+
+func (u *Union) String() string {
+	types := []string{}
+	for _, t := range u.Types {
+		types = append(types, t.String())
+	}
+	return strings.Join(types, " | ")
+}
+
+// Equal reports whether two types are structurally identical.
+func Equal(a, b Type) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch a := a.(type) {
+	case Basic:
+		b, ok := b.(Basic)
+		return ok && a == b
+
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Equal(a.Element, b.Element)
+
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && Equal(a.Key, b.Key) && Equal(a.Value, b.Value)
+
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Params) != len(b.Params) || a.Variadic != b.Variadic {
+			return false
+		}
+		for i := range a.Params {
+			if !Equal(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return Equal(a.Return, b.Return)
+
+	case *Union:
+		b, ok := b.(*Union)
+		if !ok || len(a.Types) != len(b.Types) {
+			return false
+		}
+		for _, t := range a.Types {
+			if !contains(b.Types, t) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// Join returns the smallest type that describes values of both types. A nil
+// type stands for "no value yet" and joins to the other type.
+func Join(a, b Type) Type {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a == pending:
+		return b
+	case b == pending:
+		return a
+	case a == Unknown || b == Unknown:
+		return Unknown
+	case Equal(a, b):
+		return a
+	}
+
+	if a, ok := a.(*Array); ok {
+		if b, ok := b.(*Array); ok {
+			return &Array{Element: Join(a.Element, b.Element)}
+		}
+	}
+
+	if a, ok := a.(*Hash); ok {
+		if b, ok := b.(*Hash); ok {
+			return &Hash{Key: Join(a.Key, b.Key), Value: Join(a.Value, b.Value)}
+		}
+	}
+
+	types := []Type{}
+	for _, t := range append(variants(a), variants(b)...) {
+		if !contains(types, t) {
+			types = append(types, t)
+		}
+	}
+
+	if len(types) > maxUnionSize {
+		return Unknown
+	}
+
+	return &Union{Types: types}
+}
+
+// IsConcrete reports whether the type is known exactly. Checks only report
+// errors for concrete types, so guesses never produce false positives.
+func IsConcrete(t Type) bool {
+	switch t.(type) {
+	case *Union, nil:
+		return false
+	}
+	return t != Unknown && t != pending
+}
+
+// resolvePending replaces types that stayed pending with Unknown.
+func resolvePending(t Type) Type {
+	switch t := t.(type) {
+	case Basic:
+		if t == pending {
+			return Unknown
+		}
+
+	case *Array:
+		if t.Element != nil {
+			return &Array{Element: resolvePending(t.Element)}
+		}
+
+	case *Hash:
+		if t.Key != nil && t.Value != nil {
+			return &Hash{Key: resolvePending(t.Key), Value: resolvePending(t.Value)}
+		}
+
+	case *Function:
+		params := []Type{}
+		for _, p := range t.Params {
+			params = append(params, resolvePending(p))
+		}
+		return &Function{Params: params, Return: resolvePending(t.Return), Variadic: t.Variadic}
+
+	case *Union:
+		var result Type
+		for _, v := range t.Types {
+			result = Join(result, resolvePending(v))
+		}
+		return result
+	}
+
+	return t
+}
+
+func variants(t Type) []Type {
+	if u, ok := t.(*Union); ok {
+		return u.Types
+	}
+	return []Type{t}
+}
+
+func contains(types []Type, t Type) bool {
+	for _, other := range types {
+		if Equal(other, t) {
+			return true
+		}
+	}
+	return false
+}
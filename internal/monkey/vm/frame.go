@@ -0,0 +1,22 @@
+package vm
+
+import (
+	"github.com/marcsek/monkey-language-server/internal/monkey/code"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+)
+
+// Frame is a single function call. Locals of the call live on the stack,
+// starting at basePointer.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
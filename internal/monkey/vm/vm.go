@@ -0,0 +1,504 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/code"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+)
+
+const (
+	StackSize   = 2048
+	GlobalsSize = 65536
+	MaxFrames   = 1024
+)
+
+// contextCheckInterval is the number of instructions between checks of the
+// context.
+const contextCheckInterval = 1024
+
+// VM runs bytecode of the compiler. Output of puts goes to out. Runtime errors
+// are reported with the same messages as the evaluator.
+type VM struct {
+	constants []object.Object
+	globals   []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next free slot, top of the stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	out io.Writer
+}
+
+func New(bytecode *compiler.Bytecode, out io.Writer) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants: bytecode.Constants,
+		globals:   make([]object.Object, GlobalsSize),
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		out: out,
+	}
+}
+
+// NewWithGlobalsState runs the bytecode with globals of a previous run, so a
+// program compiled piece by piece keeps its variables.
+func NewWithGlobalsState(bytecode *compiler.Bytecode, out io.Writer, globals []object.Object) *VM {
+	vm := New(bytecode, out)
+	vm.globals = globals
+	return vm
+}
+
+// LastPoppedStackElem is the value of the last expression statement.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext stops the run with an error when the context is done, so programs
+// that never finish can be interrupted.
+func (vm *VM) RunContext(ctx context.Context) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for steps := 1; vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1; steps++ {
+		if steps%contextCheckInterval == 0 {
+			switch err := ctx.Err(); {
+			case errors.Is(err, context.DeadlineExceeded):
+				return fmt.Errorf("time limit exceeded")
+			case err != nil:
+				return fmt.Errorf("evaluation cancelled")
+			}
+		}
+
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpTrue:
+			err = vm.push(object.TRUE)
+
+		case code.OpFalse:
+			err = vm.push(object.FALSE)
+
+		case code.OpNull:
+			err = vm.push(object.NULL)
+
+		case code.OpBang:
+			err = vm.push(object.NativeBoolToBooleanObject(!isTruthy(vm.pop())))
+
+		case code.OpMinus:
+			operand := vm.pop()
+			integer, ok := operand.(*object.Integer)
+			if !ok {
+				return fmt.Errorf("unknown operator: -%s", typeName(operand))
+			}
+			err = vm.push(&object.Integer{Value: -integer.Value})
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err = vm.push(vm.globals[globalIndex])
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			builtin, _ := object.GetBuiltinByName(object.Builtins[builtinIndex])
+			err = vm.push(builtin)
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err = vm.executeIndexExpression(left, index)
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// A return at the top level ends the program
+			if vm.framesIndex == 1 {
+				vm.stack[vm.sp] = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(returnValue)
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(object.NULL)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		default:
+			def, lookupErr := code.Lookup(byte(op))
+			if lookupErr != nil {
+				return lookupErr
+			}
+			return fmt.Errorf("unhandled opcode: %s", def.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// executeBinaryOperation follows evalInfixExpression of the evaluator.
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return vm.executeIntegerOperation(op, left.(*object.Integer).Value, right.(*object.Integer).Value)
+
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return vm.executeStringOperation(op, left.(*object.String).Value, right.(*object.String).Value)
+
+	case op == code.OpEqual:
+		return vm.push(object.NativeBoolToBooleanObject(left == right))
+
+	case op == code.OpNotEqual:
+		return vm.push(object.NativeBoolToBooleanObject(left != right))
+
+	case left.Type() != right.Type():
+		return fmt.Errorf("type mismatch: %s %s %s", typeName(left), operator(op), typeName(right))
+	}
+
+	return fmt.Errorf("unknown operator: %s %s %s", typeName(left), operator(op), typeName(right))
+}
+
+func (vm *VM) executeIntegerOperation(op code.Opcode, left, right int64) error {
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: left + right})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: left - right})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: left * right})
+	case code.OpDiv:
+		if right == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(&object.Integer{Value: left / right})
+	case code.OpGreaterThan:
+		return vm.push(object.NativeBoolToBooleanObject(left > right))
+	case code.OpEqual:
+		return vm.push(object.NativeBoolToBooleanObject(left == right))
+	case code.OpNotEqual:
+		return vm.push(object.NativeBoolToBooleanObject(left != right))
+	}
+
+	return fmt.Errorf("unknown operator: INTEGER %s INTEGER", operator(op))
+}
+
+func (vm *VM) executeStringOperation(op code.Opcode, left, right string) error {
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: left + right})
+	case code.OpEqual:
+		return vm.push(object.NativeBoolToBooleanObject(left == right))
+	case code.OpNotEqual:
+		return vm.push(object.NativeBoolToBooleanObject(left != right))
+	}
+
+	return fmt.Errorf("unknown operator: STRING %s STRING", operator(op))
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return vm.push(object.NULL)
+		}
+		return vm.push(elements[i])
+
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", typeName(index))
+		}
+
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return vm.push(object.NULL)
+		}
+		return vm.push(pair.Value)
+	}
+
+	return fmt.Errorf("index operator not supported: %s", typeName(left))
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", typeName(key))
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	}
+
+	return fmt.Errorf("not a function: %s", typeName(callee))
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments. got=%d, want=%d", numArgs, cl.Fn.NumParameters)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	return nil
+}
+
+// callBuiltin turns errors returned by the builtin into errors of the VM.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(vm.out, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case object.NULL, object.FALSE:
+		return false
+	}
+	return true
+}
+
+// typeName is the type of the object in runtime errors. Functions are closures
+// in the VM, they are named like in the evaluator.
+func typeName(o object.Object) object.ObjectType {
+	if o.Type() == object.CLOSURE_OBJ {
+		return object.FUNCTION_OBJ
+	}
+	return o.Type()
+}
+
+func operator(op code.Opcode) string {
+	switch op {
+	case code.OpAdd:
+		return "+"
+	case code.OpSub:
+		return "-"
+	case code.OpMul:
+		return "*"
+	case code.OpDiv:
+		return "/"
+	case code.OpGreaterThan:
+		return ">"
+	case code.OpEqual:
+		return "=="
+	case code.OpNotEqual:
+		return "!="
+	}
+	return "?"
+}
@@ -0,0 +1,260 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+)
+
+var (
+	buff       bytes.Buffer
+	MockLogger = log.New(&buff, "", log.LstdFlags)
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5", 5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"!true", false},
+		{"!!5", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"(1 < 2) == true", true},
+		{"1 == true", false},
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (false) { 10 }", nil},
+		{"if (true) { let a = 1; }", nil},
+		{"!if (false) { 5 }", true},
+		{"if (true) { return 10; } 20", 10},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let early = fn() { return 1; 2 }; early()", 1},
+		{"let empty = fn() { }; empty()", nil},
+		{"let add = fn(x, y) { let sum = x + y; sum }; add(5 + 5, add(5, 5));", 20},
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(2);", 4},
+		{"let f = fn(a) { let g = fn(b) { fn(c) { a + b + c } }; g(2) }; f(1)(3)", 6},
+		{"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)", 610},
+		{"let wrapper = fn() { let count = fn(x) { if (x == 0) { 0 } else { count(x - 1) } }; count(5) }; wrapper()", 0},
+		{"[1, 2 * 2, 3 + 3][1]", 4},
+		{"[1, 2, 3][3]", nil},
+		{`len("four")`, 4},
+		{"first(rest(push([1, 2], 3)))", 2},
+		{`{"one": 1, "two": 2}["two"]`, 2},
+		{`{"one": 1}["two"]`, nil},
+		{"{true: 5}[true]", 5},
+	}
+
+	for _, tt := range tests {
+		vm, err := runVM(tt.input, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %s", tt.input, err)
+		}
+
+		result := vm.LastPoppedStackElem()
+
+		switch expected := tt.expected.(type) {
+		case int:
+			integer, ok := result.(*object.Integer)
+			if !ok || integer.Value != int64(expected) {
+				t.Fatalf("Wrong result of %q, want=%d; got=%s", tt.input, expected, inspect(result))
+			}
+		case bool:
+			if result != object.NativeBoolToBooleanObject(expected) {
+				t.Fatalf("Wrong result of %q, want=%t; got=%s", tt.input, expected, inspect(result))
+			}
+		case string:
+			str, ok := result.(*object.String)
+			if !ok || str.Value != expected {
+				t.Fatalf("Wrong result of %q, want=%q; got=%s", tt.input, expected, inspect(result))
+			}
+		case nil:
+			if result != object.NULL {
+				t.Fatalf("Wrong result of %q, want=null; got=%s", tt.input, inspect(result))
+			}
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{"1 / 0", "division by zero"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{"1(2)", "not a function: INTEGER"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"fn() {} + 1", "type mismatch: FUNCTION + INTEGER"},
+		{"let f = fn() { f() }; f()", "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		_, err := runVM(tt.input, &bytes.Buffer{})
+		if err == nil {
+			t.Fatalf("No error for %q", tt.input)
+		}
+
+		if err.Error() != tt.expectedMessage {
+			t.Fatalf("Wrong error message for %q, want=%q; got=%q", tt.input, tt.expectedMessage, err.Error())
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(12)"
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	tests := []struct {
+		ctx             context.Context
+		expectedMessage string
+	}{
+		{cancelled, "evaluation cancelled"},
+		{expired, "time limit exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		c := compiler.New(MockLogger)
+		if err := c.Compile(program); err != nil {
+			t.Fatalf("Compilation failed: %s", err)
+		}
+
+		err := New(c.Bytecode(), &bytes.Buffer{}).RunContext(tt.ctx)
+		if err == nil {
+			t.Fatalf("No error, want=%q", tt.expectedMessage)
+		}
+
+		if err.Error() != tt.expectedMessage {
+			t.Fatalf("Wrong error message, want=%q; got=%q", tt.expectedMessage, err.Error())
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	var out bytes.Buffer
+
+	vm, err := runVM(`puts("a", 1, [true])`, &out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if vm.LastPoppedStackElem() != object.NULL {
+		t.Fatalf("puts should return null, got=%s", inspect(vm.LastPoppedStackElem()))
+	}
+
+	if out.String() != "a\n1\n[true]\n" {
+		t.Fatalf("Wrong output, want=%q; got=%q", "a\n1\n[true]\n", out.String())
+	}
+}
+
+func TestSelfReferencingLet(t *testing.T) {
+	// The value is compiled before the name is defined, so these never reach
+	// the VM with an unset binding
+	tests := []string{
+		"let x = x; x",
+		"let x = x + 1;",
+		"let y = puts(y);",
+		"fn() { let x = x; x }()",
+	}
+
+	for _, input := range tests {
+		c := compiler.New(MockLogger)
+		if err := c.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+			t.Fatalf("Unexpected compiler error for %q: %s", input, err)
+		}
+
+		errors := c.Errors()
+		if len(errors) != 1 || errors[0].Code != compiler.UndefinedVariable {
+			t.Fatalf("Expected an undefined variable error for %q, got=%v", input, errors)
+		}
+	}
+
+	// A shadowing let reads the previous binding
+	vm, err := runVM("let x = 1; let x = x + 1; x", &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	integer, ok := vm.LastPoppedStackElem().(*object.Integer)
+	if !ok || integer.Value != 2 {
+		t.Fatalf("Wrong result, want=2; got=%s", inspect(vm.LastPoppedStackElem()))
+	}
+}
+
+func TestGlobalsState(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable(token.Range{})
+	for i, name := range object.Builtins {
+		symbolTable.DefineBuiltin(i, name)
+	}
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	var result object.Object
+	for _, line := range []string{"let a = 1;", "let add = fn(x) { x + a };", "add(len([1, 2]))"} {
+		c := compiler.NewWithState(MockLogger, symbolTable, constants)
+		if err := c.Compile(parser.New(lexer.New(line)).ParseProgram()); err != nil {
+			t.Fatalf("Unexpected compiler error: %s", err)
+		}
+
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+
+		vm := NewWithGlobalsState(bytecode, &bytes.Buffer{}, globals)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("Unexpected error for %q: %s", line, err)
+		}
+		result = vm.LastPoppedStackElem()
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 3 {
+		t.Fatalf("Wrong result, want=3; got=%s", inspect(result))
+	}
+}
+
+func runVM(input string, out *bytes.Buffer) (*VM, error) {
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	c := compiler.New(MockLogger)
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+
+	vm := New(c.Bytecode(), out)
+	return vm, vm.Run()
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
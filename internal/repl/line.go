@@ -0,0 +1,238 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads a single line of input. Pending is the unfinished input of
+// the previous lines.
+type lineReader interface {
+	readLine(prompt, pending string) (string, error)
+
+	// interruptible returns a context that is cancelled when the user
+	// interrupts the evaluation of the last line. The returned function has to
+	// be called once the evaluation ends.
+	interruptible() (context.Context, context.CancelFunc)
+}
+
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func newPlainReader(in io.Reader, out io.Writer) *plainReader {
+	return &plainReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+func (r *plainReader) readLine(prompt, pending string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return r.scanner.Text(), nil
+}
+
+// Interrupts of plain input are signals, they end the whole process.
+func (r *plainReader) interruptible() (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.Background())
+}
+
+const (
+	keyInterrupt = 3
+	keyEOF       = 4
+	keyBell      = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// terminalReader edits the line itself, the terminal is expected to pass keys
+// through without echoing them. Keys are read in the background, so Ctrl-C
+// can be noticed while a line is evaluated.
+type terminalReader struct {
+	keys     chan keyRead
+	out      io.Writer
+	complete func(input string) []string
+
+	// typeahead are keys pressed during an evaluation
+	typeahead []keyRead
+}
+
+type keyRead struct {
+	key byte
+	err error
+}
+
+func newTerminalReader(in io.Reader, out io.Writer, complete func(input string) []string) *terminalReader {
+	r := &terminalReader{keys: make(chan keyRead), out: out, complete: complete}
+	go r.readKeys(bufio.NewReader(in))
+	return r
+}
+
+// readKeys passes keys to the reader until in fails, the channel is closed
+// after the error.
+func (r *terminalReader) readKeys(in *bufio.Reader) {
+	defer close(r.keys)
+
+	for {
+		key, err := in.ReadByte()
+		r.keys <- keyRead{key, err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *terminalReader) readKey() (byte, error) {
+	if len(r.typeahead) > 0 {
+		k := r.typeahead[0]
+		r.typeahead = r.typeahead[1:]
+		return k.key, k.err
+	}
+
+	k, ok := <-r.keys
+	if !ok {
+		return 0, io.EOF
+	}
+	return k.key, k.err
+}
+
+// interruptible cancels the context on Ctrl-C, other keys are kept for the
+// next line.
+func (r *terminalReader) interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case k, ok := <-r.keys:
+				if !ok {
+					r.typeahead = append(r.typeahead, keyRead{err: io.EOF})
+					return
+				}
+				if k.err == nil && k.key == keyInterrupt {
+					cancel()
+					return
+				}
+				r.typeahead = append(r.typeahead, k)
+			}
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-done
+	}
+}
+
+func (r *terminalReader) readLine(prompt, pending string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	line := ""
+	for {
+		key, err := r.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case key == '\r' || key == '\n':
+			fmt.Fprint(r.out, "\n")
+			return line, nil
+
+		case key == keyBackspace || key == keyDelete:
+			if line != "" {
+				_, size := utf8.DecodeLastRuneInString(line)
+				line = line[:len(line)-size]
+				fmt.Fprint(r.out, "\b \b")
+			}
+
+		case key == keyInterrupt:
+			fmt.Fprint(r.out, "^C\n")
+			return "", errInterrupted
+
+		case key == keyEOF:
+			if line == "" && pending == "" {
+				fmt.Fprint(r.out, "\n")
+				return "", io.EOF
+			}
+
+		case key == keyTab:
+			line = r.completeLine(prompt, pending, line)
+
+		case key == keyEscape:
+			r.skipEscapeSequence()
+
+		case key >= ' ':
+			line += string(key)
+			r.out.Write([]byte{key})
+		}
+	}
+}
+
+// completeLine extends the last word by the prefix all candidates share, the
+// candidates are listed when it can't be extended.
+func (r *terminalReader) completeLine(prompt, pending, line string) string {
+	candidates := r.complete(pending + line)
+	if len(candidates) == 0 {
+		r.out.Write([]byte{keyBell})
+		return line
+	}
+
+	word := lastWord(line)
+	common := commonPrefix(candidates)
+
+	if len(common) > len(word) {
+		fmt.Fprint(r.out, common[len(word):])
+		return line + common[len(word):]
+	}
+
+	if len(candidates) > 1 {
+		fmt.Fprintf(r.out, "\n%s\n%s%s", strings.Join(candidates, "  "), prompt, line)
+	}
+	return line
+}
+
+// skipEscapeSequence drops keys like arrows, which aren't supported.
+func (r *terminalReader) skipEscapeSequence() {
+	next, err := r.readKey()
+	if err != nil || next != '[' {
+		return
+	}
+
+	for {
+		b, err := r.readKey()
+		if err != nil || b >= 0x40 && b <= 0x7e {
+			return
+		}
+	}
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,241 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/marcsek/monkey-language-server/internal/monkey/ast"
+	"github.com/marcsek/monkey-language-server/internal/monkey/compiler"
+	"github.com/marcsek/monkey-language-server/internal/monkey/lexer"
+	"github.com/marcsek/monkey-language-server/internal/monkey/object"
+	"github.com/marcsek/monkey-language-server/internal/monkey/parser"
+	"github.com/marcsek/monkey-language-server/internal/monkey/token"
+	"github.com/marcsek/monkey-language-server/internal/monkey/vm"
+)
+
+const (
+	Prompt             = ">> "
+	ContinuationPrompt = ".. "
+)
+
+// Start reads inputs from in until it's closed. Inputs with unclosed brackets
+// continue on the next line. When terminal is set, in is expected to be a
+// terminal without line buffering and echo, lines are edited by the REPL and
+// tab completes names.
+func Start(in io.Reader, out io.Writer, terminal bool) {
+	session := NewSession()
+
+	var reader lineReader = newPlainReader(in, out)
+	if terminal {
+		reader = newTerminalReader(in, out, session.Complete)
+	}
+
+	pending := ""
+	for {
+		prompt := Prompt
+		if pending != "" {
+			prompt = ContinuationPrompt
+		}
+
+		line, err := reader.readLine(prompt, pending)
+		if errors.Is(err, errInterrupted) {
+			pending = ""
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		input := pending + line
+		if !Balanced(input) {
+			pending = input + "\n"
+			continue
+		}
+		pending = ""
+
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		ctx, done := reader.interruptible()
+		session.Eval(ctx, input, out)
+		done()
+	}
+}
+
+// Balanced reports whether every bracket of the input is closed.
+func Balanced(input string) bool {
+	depth := 0
+
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			depth--
+		}
+	}
+
+	return depth <= 0
+}
+
+// Session keeps globals of every evaluated input, so later inputs can use
+// them. Inputs that fail leave the session unchanged.
+type Session struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+
+	logger *log.Logger
+}
+
+func NewSession() *Session {
+	symbolTable := compiler.NewSymbolTable(token.Range{})
+	for i, name := range object.Builtins {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	return &Session{
+		symbolTable: symbolTable,
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		logger:      log.New(io.Discard, "", 0),
+	}
+}
+
+// Eval runs the input and prints its value, diagnostics or the runtime error
+// to out, along with the output of puts. The run stops when the context is
+// cancelled.
+func (s *Session) Eval(ctx context.Context, input string, out io.Writer) {
+	// A bug in the compiler or the VM shouldn't end the whole session, the
+	// state is only kept after a successful run
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(out, "internal error: %v\n", r)
+		}
+	}()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) != 0 {
+		for _, err := range errors {
+			printDiagnostic(out, input, err.Range, err.Message)
+		}
+		return
+	}
+
+	symbolTable := s.symbolTable.Clone()
+	comp := compiler.NewWithState(s.logger, symbolTable, s.constants)
+
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(out, "compilation failed: %s\n", err)
+		return
+	}
+	if errors := comp.Errors(); len(errors) != 0 {
+		for _, err := range errors {
+			printDiagnostic(out, input, err.Range, err.Message)
+		}
+		return
+	}
+
+	bytecode := comp.Bytecode()
+
+	machine := vm.NewWithGlobalsState(bytecode, out, s.globals)
+	if err := machine.RunContext(ctx); err != nil {
+		fmt.Fprintf(out, "runtime error: %s\n", err)
+		return
+	}
+
+	s.symbolTable = symbolTable
+	s.constants = bytecode.Constants
+
+	// Let statements don't leave a value behind
+	if len(program.Statements) == 0 {
+		return
+	}
+	last := program.Statements[len(program.Statements)-1]
+	if _, ok := last.(*ast.ExpressionStatement); ok {
+		fmt.Fprintln(out, machine.LastPoppedStackElem().Inspect())
+	}
+}
+
+// Complete returns names that can complete the last word of the input, the
+// input ends at the cursor.
+func (s *Session) Complete(input string) []string {
+	prefix := lastWord(input)
+
+	// Scopes of unclosed blocks end at the end of the input, the newline keeps
+	// the cursor inside them
+	program := parser.New(lexer.New(input + "\n")).ParseProgram()
+
+	comp := compiler.NewWithState(s.logger, s.symbolTable.Clone(), s.constants)
+	comp.Compile(program)
+
+	lines := strings.Split(input, "\n")
+	position := token.Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+
+	seen := map[string]bool{}
+	candidates := []string{}
+
+	for _, item := range comp.Completion(position) {
+		if !strings.HasPrefix(item.Label, prefix) || seen[item.Label] {
+			continue
+		}
+		seen[item.Label] = true
+		candidates = append(candidates, item.Label)
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
+
+func lastWord(input string) string {
+	start := len(input)
+	for start > 0 && isWordChar(input[start-1]) {
+		start--
+	}
+	return input[start:]
+}
+
+func isWordChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '_'
+}
+
+// printDiagnostic prints the message with the source line it points to and
+// carets under the range. Ranges spanning more lines are underlined to the end
+// of their first line.
+func printDiagnostic(out io.Writer, input string, r token.Range, message string) {
+	fmt.Fprintf(out, "%d:%d: %s\n", r.Start.Line+1, r.Start.Character+1, message)
+
+	lines := strings.Split(input, "\n")
+	if r.Start.Line >= len(lines) {
+		return
+	}
+	line := lines[r.Start.Line]
+
+	start := min(r.Start.Character, len(line))
+	end := len(line)
+	if r.End.Line == r.Start.Line {
+		end = min(r.End.Character, len(line))
+	}
+
+	// Tabs are kept, so the carets line up with the source
+	var padding strings.Builder
+	for _, ch := range line[:start] {
+		if ch == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	fmt.Fprintf(out, "  %s\n", line)
+	fmt.Fprintf(out, "  %s%s\n", padding.String(), strings.Repeat("^", max(end-start, 1)))
+}
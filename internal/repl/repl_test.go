@@ -0,0 +1,184 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 5;", ""},
+		{"a * 2", "10\n"},
+		{"let add = fn(x) { x + a };", ""},
+		{"add(1)", "6\n"},
+		{"let b = 1 / 0;", "runtime error: division by zero\n"},
+		{"b", "1:1: undefined variable b\n  b\n  ^\n"},
+		{"let c = a + d;", "1:13: undefined variable d\n  let c = a + d;\n              ^\n"},
+		{"c", "1:1: undefined variable c\n  c\n  ^\n"},
+		{`puts("x")`, "x\nnull\n"},
+		{"let x = x + 1;", "1:9: undefined variable x\n  let x = x + 1;\n          ^\n"},
+		{"# only a comment", ""},
+	}
+
+	session := NewSession()
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		session.Eval(context.Background(), tt.input, &out)
+
+		if out.String() != tt.expected {
+			t.Fatalf("Wrong output of %q, want=%q; got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestPanicBecomesInternalError(t *testing.T) {
+	session := NewSession()
+	globals := session.globals
+	session.globals = nil
+
+	var out bytes.Buffer
+	session.Eval(context.Background(), "let a = 1;", &out)
+	if !strings.HasPrefix(out.String(), "internal error: ") {
+		t.Fatalf("Wrong output after panic, got=%q", out.String())
+	}
+
+	// The failed input doesn't leave a definition behind
+	session.globals = globals
+	out.Reset()
+	session.Eval(context.Background(), "a", &out)
+	if expected := "1:1: undefined variable a\n  a\n  ^\n"; out.String() != expected {
+		t.Fatalf("Wrong output, want=%q; got=%q", expected, out.String())
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	var out bytes.Buffer
+	NewSession().Eval(context.Background(), "let f = fn(x) {\n\tlet = x\n}", &out)
+
+	expected := "2:6: expected next token to be IDENT, got = instead\n  \tlet = x\n  \t    ^\n"
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Fatalf("Wrong diagnostic, want=%q; got=%q", expected, out.String())
+	}
+}
+
+func TestStart(t *testing.T) {
+	input := "let f = fn(x) {\n  x * 2\n}\n\nf(\n  [1, 2][1]\n)\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, false)
+
+	expected := ">> .. .. >> >> .. .. 4\n>> "
+	if out.String() != expected {
+		t.Fatalf("Wrong output, want=%q; got=%q", expected, out.String())
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	in, keys := io.Pipe()
+
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		Start(in, &out, true)
+		close(done)
+	}()
+
+	// Without the interrupt the call would run for ages
+	keys.Write([]byte("let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(60)\r"))
+	keys.Write([]byte("\x03"))
+	keys.Write([]byte("1\r"))
+	keys.Close()
+	<-done
+
+	expected := "runtime error: evaluation cancelled\n>> 1\n1\n>> "
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Fatalf("Wrong output, want suffix=%q; got=%q", expected, out.String())
+	}
+}
+
+func TestBalanced(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let a = 1;", true},
+		{"fn(x) {", false},
+		{"[1, (2", false},
+		{"fn(x) {\n x }", true},
+		{`"{"`, true},
+		{"# {", true},
+		{"}", true},
+	}
+
+	for _, tt := range tests {
+		if Balanced(tt.input) != tt.expected {
+			t.Fatalf("Wrong result of %q, want=%t; got=%t", tt.input, tt.expected, !tt.expected)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	session := NewSession()
+	session.Eval(context.Background(), "let first_value = 1;", &bytes.Buffer{})
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fir", []string{"first", "first_value"}},
+		{"first_", []string{"first_value"}},
+		{"let f = fn(param) {\n  par", []string{"param"}},
+		{"tr", []string{"true"}},
+		{"xyz", []string{}},
+	}
+
+	for _, tt := range tests {
+		candidates := session.Complete(tt.input)
+
+		if strings.Join(candidates, ",") != strings.Join(tt.expected, ",") {
+			t.Fatalf("Wrong candidates for %q, want=%v; got=%v", tt.input, tt.expected, candidates)
+		}
+	}
+}
+
+func TestTerminalReader(t *testing.T) {
+	session := NewSession()
+	session.Eval(context.Background(), "let first_value = 1;", &bytes.Buffer{})
+
+	tests := []struct {
+		keys           string
+		expectedLine   string
+		expectedOutput string
+	}{
+		{"fi\t_\t\r", "first_value", ">> first_value\n"},
+		{"fi\t\t\r", "first", ">> first\nfirst  first_value\n>> first\n"},
+		{"ab\x7fc\r", "ac", ">> ab\b \bc\n"},
+		{"le\x1b[Dt\r", "let", ">> let\n"},
+		{"zz\t\r", "zz", ">> zz\a\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		reader := newTerminalReader(strings.NewReader(tt.keys), &out, session.Complete)
+
+		line, err := reader.readLine(Prompt, "")
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %s", tt.keys, err)
+		}
+
+		if line != tt.expectedLine {
+			t.Fatalf("Wrong line for %q, want=%q; got=%q", tt.keys, tt.expectedLine, line)
+		}
+
+		if out.String() != tt.expectedOutput {
+			t.Fatalf("Wrong output for %q, want=%q; got=%q", tt.keys, tt.expectedOutput, out.String())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Reader reads messages from a stream. Unlike bufio.Scanner with SplicFunc it
+// has no limit on the message size, the content is read straight into a buffer
+// of the length announced in the header.
+type Reader struct {
+	reader *bufio.Reader
+
+	// resync is set after a framing error, the content of the broken message
+	// wasn't consumed, so everything up to the next line starting with
+	// Content-Length is skipped
+	resync bool
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReaderSize(reader, MaxHeaderLineLength)}
+}
+
+// ReadMessage returns io.EOF when the stream ends between messages. Content
+// errors leave the stream in a consistent state, so reading can continue.
+// After framing errors the next read skips to the next line starting with a
+// Content-Length header.
+func (r *Reader) ReadMessage() (string, []byte, error) {
+	header, err := r.readHeader()
+	if err != nil {
+		return "", nil, err
+	}
+
+	content := make([]byte, header.ContentLength)
+	if _, err := io.ReadFull(r.reader, content); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", nil, err
+	}
+
+	return DecodeContent(content)
+}
+
+func (r *Reader) readHeader() (Header, error) {
+	var header bytes.Buffer
+
+	for {
+		line, err := r.reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			if err := r.skipLine(); err != nil {
+				return Header{}, err
+			}
+			if r.resync {
+				continue
+			}
+			r.resync = true
+			return Header{}, ErrHeaderLineTooLong
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) && header.Len() == 0 && len(line) == 0 {
+				return Header{}, io.EOF
+			}
+			if errors.Is(err, io.EOF) {
+				return Header{}, io.ErrUnexpectedEOF
+			}
+			return Header{}, err
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+
+		if r.resync {
+			if !bytes.HasPrefix(bytes.ToLower(line), []byte("content-length:")) {
+				continue
+			}
+			r.resync = false
+		}
+
+		if len(line) == 0 {
+			// Stray empty lines between messages are skipped
+			if header.Len() == 0 {
+				continue
+			}
+			break
+		}
+
+		header.Write(line)
+		header.WriteString("\r\n")
+	}
+
+	result, err := ParseHeader(header.Bytes())
+	if err != nil {
+		r.resync = true
+	}
+	return result, err
+}
+
+// skipLine drops the rest of a line that didn't fit into the buffer.
+func (r *Reader) skipLine() error {
+	for {
+		_, err := r.reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+}
@@ -3,14 +3,40 @@ package rpc
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+)
+
+// MaxContentLength guards against allocating absurd amounts of memory because
+// of a corrupted header.
+const MaxContentLength = 256 << 20
+
+// MaxHeaderLineLength bounds a line of the header including its line ending,
+// so a stream without newlines can't grow the header buffer forever.
+const MaxHeaderLineLength = 4096
+
+var (
+	// Framing errors, the stream can't be trusted after one of these
+	ErrMalformedHeader      = errors.New("malformed header")
+	ErrMissingContentLength = errors.New("missing Content-Length header")
+	ErrInvalidContentLength = errors.New("invalid Content-Length header")
+	ErrHeaderLineTooLong    = errors.New("header line too long")
+
+	// Content errors, the message was framed correctly but its content is invalid
+	ErrMalformedContent = errors.New("malformed content")
 )
 
 type RequestMessage struct {
 	Method string `json:"method"`
 }
 
+type Header struct {
+	ContentLength int
+	ContentType   string
+}
+
 func EncodeMessage(msg any) string {
 	content, err := json.Marshal(msg)
 	if err != nil {
@@ -21,41 +47,88 @@ func EncodeMessage(msg any) string {
 }
 
 func DecodeMessage(msg []byte) (string, []byte, error) {
-	header, content, found := bytes.Cut(msg, []byte("\r\n\r\n"))
+	headerBytes, content, found := bytes.Cut(msg, []byte("\r\n\r\n"))
 	if !found {
-		return "", nil, fmt.Errorf("Incorrect message format (did not find separator)")
+		return "", nil, fmt.Errorf("%w: did not find separator", ErrMalformedHeader)
 	}
 
-	contentLengthBytes := header[len("Content-Length: "):]
-	contentLength, err := strconv.Atoi(string(contentLengthBytes))
+	header, err := ParseHeader(headerBytes)
 	if err != nil {
-		return "", nil, fmt.Errorf("Incorrect message format (wrong content length)")
+		return "", nil, err
+	}
+
+	if len(content) < header.ContentLength {
+		return "", nil, fmt.Errorf(
+			"%w: content is shorter than %d bytes",
+			ErrInvalidContentLength,
+			header.ContentLength,
+		)
 	}
 
+	return DecodeContent(content[:header.ContentLength])
+}
+
+// DecodeContent extracts the method of a message whose header was already consumed.
+func DecodeContent(content []byte) (string, []byte, error) {
 	var requestMessage RequestMessage
-	if err := json.Unmarshal(content[:contentLength], &requestMessage); err != nil {
-		return "", nil, fmt.Errorf("Incorrect message foramt (can't decode content)")
+	if err := json.Unmarshal(content, &requestMessage); err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrMalformedContent, err)
+	}
+
+	return requestMessage.Method, content, nil
+}
+
+// ParseHeader parses a header block without the terminating empty line. Field
+// names are case-insensitive, unknown fields are ignored.
+func ParseHeader(header []byte) (Header, error) {
+	result := Header{ContentLength: -1}
+
+	for _, line := range strings.Split(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return Header{}, fmt.Errorf("%w: %q", ErrMalformedHeader, line)
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "content-length":
+			contentLength, err := strconv.Atoi(value)
+			if err != nil || contentLength < 0 || contentLength > MaxContentLength {
+				return Header{}, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+			}
+			result.ContentLength = contentLength
+
+		case "content-type":
+			result.ContentType = value
+		}
+	}
+
+	if result.ContentLength < 0 {
+		return Header{}, ErrMissingContentLength
 	}
 
-	return requestMessage.Method, content[:contentLength], nil
+	return result, nil
 }
 
 func SplicFunc(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	header, content, found := bytes.Cut(data, []byte("\r\n\r\n"))
+	headerBytes, content, found := bytes.Cut(data, []byte("\r\n\r\n"))
 	if !found {
 		return 0, nil, nil
 	}
 
-	contentLengthBytes := header[len("Content-Length: "):]
-	contentLength, err := strconv.Atoi(string(contentLengthBytes))
+	header, err := ParseHeader(headerBytes)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	if len(content) < contentLength {
+	if len(content) < header.ContentLength {
 		return 0, nil, nil
 	}
 
-	totalLength := len(header) + 4 + contentLength
+	totalLength := len(headerBytes) + 4 + header.ContentLength
 	return totalLength, data[:totalLength], nil
 }
@@ -1,7 +1,10 @@
 package rpc_test
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/marcsek/monkey-language-server/internal/rpc"
@@ -104,3 +107,153 @@ func TestSplitFunc(t *testing.T) {
 		}
 	}
 }
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		Input               string
+		ExpectedLength      int
+		ExpectedContentType string
+		ExpectedErr         error
+	}{
+		{"Content-Length: 15", 15, "", nil},
+		{"content-length:15\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8", 15,
+			"application/vscode-jsonrpc; charset=utf-8", nil},
+		{"Content-Type: application/vscode-jsonrpc\r\nCONTENT-LENGTH: 2", 2,
+			"application/vscode-jsonrpc", nil},
+		{"Content-Type: application/vscode-jsonrpc", 0, "", rpc.ErrMissingContentLength},
+		{"Content-Length: -1", 0, "", rpc.ErrInvalidContentLength},
+		{"Content-Length: 1d", 0, "", rpc.ErrInvalidContentLength},
+		{"Content-Length 15", 0, "", rpc.ErrMalformedHeader},
+	}
+
+	for _, test := range tests {
+		header, err := rpc.ParseHeader([]byte(test.Input))
+
+		if !errors.Is(err, test.ExpectedErr) {
+			t.Fatalf("Wrong error for %q, want=%v; got=%v", test.Input, test.ExpectedErr, err)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if header.ContentLength != test.ExpectedLength {
+			t.Fatalf("Wrong content length, want=%d; got=%d", test.ExpectedLength, header.ContentLength)
+		}
+
+		if header.ContentType != test.ExpectedContentType {
+			t.Fatalf("Wrong content type, want=%s; got=%s", test.ExpectedContentType, header.ContentType)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	large := strings.Repeat("a", 200_000)
+	largeMessage := fmt.Sprintf(`{"method":"large","params":"%s"}`, large)
+
+	input := "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n" +
+		"Content-Length: 15\r\n\r\n{\"method\":\"ok\"}" +
+		fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(largeMessage), largeMessage) +
+		"Content-Length: 5\r\n\r\n{oops" +
+		"Content-Length: 18\r\n\r\n{\"method\":\"after\"}"
+
+	reader := rpc.NewReader(strings.NewReader(input))
+
+	expected := []struct {
+		Method string
+		Length int
+		Err    error
+	}{
+		{"ok", 15, nil},
+		{"large", len(largeMessage), nil},
+		{"", 0, rpc.ErrMalformedContent},
+		{"after", 18, nil},
+		{"", 0, io.EOF},
+	}
+
+	for _, exp := range expected {
+		method, content, err := reader.ReadMessage()
+
+		if !errors.Is(err, exp.Err) {
+			t.Fatalf("Wrong error, want=%v; got=%v", exp.Err, err)
+		}
+
+		if method != exp.Method {
+			t.Fatalf("Wrong method, want=%s; got=%s", exp.Method, method)
+		}
+
+		if len(content) != exp.Length {
+			t.Fatalf("Wrong content length, want=%d; got=%d", exp.Length, len(content))
+		}
+	}
+}
+
+func TestReaderUnexpectedEOF(t *testing.T) {
+	reader := rpc.NewReader(strings.NewReader("Content-Length: 15\r\n\r\n{\"met"))
+
+	_, _, err := reader.ReadMessage()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Wrong error, want=%v; got=%v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestReaderResync(t *testing.T) {
+	input := "Content-Type: text\r\n\r\n{\"method\":\"lost\"}\r\n" +
+		"content-length: 16\r\n\r\n{\"method\":\"one\"}" +
+		"Content-Length: x\r\n\r\n{\"method\":\"lost\",\"params\":\"Content-Length: 1\"}\n" +
+		"Content-Length: 16\r\n\r\n{\"method\":\"two\"}"
+
+	reader := rpc.NewReader(strings.NewReader(input))
+
+	expected := []struct {
+		Method string
+		Err    error
+	}{
+		{"", rpc.ErrMissingContentLength},
+		{"one", nil},
+		{"", rpc.ErrInvalidContentLength},
+		{"two", nil},
+		{"", io.EOF},
+	}
+
+	for _, exp := range expected {
+		method, _, err := reader.ReadMessage()
+
+		if !errors.Is(err, exp.Err) {
+			t.Fatalf("Wrong error, want=%v; got=%v", exp.Err, err)
+		}
+
+		if method != exp.Method {
+			t.Fatalf("Wrong method, want=%s; got=%s", exp.Method, method)
+		}
+	}
+}
+
+func TestReaderHeaderLineTooLong(t *testing.T) {
+	input := "Content-Length: 15\r\nX-Padding: " + strings.Repeat("a", rpc.MaxHeaderLineLength) + "\r\n\r\n{\"method\":\"ok\"}\r\n" +
+		strings.Repeat("b", 2*rpc.MaxHeaderLineLength) + "\r\n" +
+		"Content-Length: 16\r\n\r\n{\"method\":\"one\"}"
+
+	reader := rpc.NewReader(strings.NewReader(input))
+
+	expected := []struct {
+		Method string
+		Err    error
+	}{
+		{"", rpc.ErrHeaderLineTooLong},
+		{"one", nil},
+		{"", io.EOF},
+	}
+
+	for _, exp := range expected {
+		method, _, err := reader.ReadMessage()
+
+		if !errors.Is(err, exp.Err) {
+			t.Fatalf("Wrong error, want=%v; got=%v", exp.Err, err)
+		}
+
+		if method != exp.Method {
+			t.Fatalf("Wrong method, want=%s; got=%s", exp.Method, method)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package sources finds Monkey source files for the command line tools.
+package sources
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Files returns the path itself for files and every .monkey file below it for
+// directories.
+func Files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files := []string{}
+	err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".monkey" {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	return files, err
+}
@@ -0,0 +1,45 @@
+package sources
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.monkey", "b.txt", filepath.Join("nested", "c.monkey")} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{dir, []string{filepath.Join(dir, "a.monkey"), filepath.Join(dir, "nested", "c.monkey")}},
+		// Files given explicitly are kept whatever their extension
+		{filepath.Join(dir, "b.txt"), []string{filepath.Join(dir, "b.txt")}},
+	}
+
+	for _, tt := range tests {
+		files, err := Files(tt.path)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", tt.path, err)
+		}
+
+		if !slices.Equal(files, tt.expected) {
+			t.Fatalf("Wrong files of %s, want=%v; got=%v", tt.path, tt.expected, files)
+		}
+	}
+
+	if _, err := Files(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("Expected an error for a missing path")
+	}
+}